@@ -0,0 +1,256 @@
+package main
+
+import (
+	"1brc/runs"
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"runtime/debug"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ==================================================================================== //
+// Bench
+// ==================================================================================== //
+// go run . bench -impl run_8,run_9 -n 3 -change "..." measurements_1b.txt
+
+// timesHeader are the columns of times.csv, Run numbers the rows and Impl is the solution benchmarked.
+var timesHeader = []string{
+	"Run", "Impl", "s/op", "allocs/op", "Change",
+	"Machine", "GOOS/GOARCH", "Go", "Commit", "Dataset", "Size", "Peak RSS", "CPU s/op",
+}
+
+// benchResult is the mean over all runs of one solution, besides PeakRSS which is the max.
+type benchResult struct {
+	Wall    time.Duration
+	Allocs  uint64
+	PeakRSS int64
+	CPU     time.Duration
+}
+
+func bench(args []string) {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	implNames := fs.String("impl", "run_9", "comma separated solutions to benchmark, of "+strings.Join(runs.Names(), ", "))
+	n := fs.Int("n", 1, "runs per solution")
+	csvPath := fs.String("csv", "times.csv", "file the results are appended to")
+	change := fs.String("change", "", "description of the change stored along the results")
+	_ = fs.Parse(args)
+
+	// checked upfront, so nothing is appended to the csv if one of them is wrong
+	if *n < 1 {
+		fmt.Fprintf(os.Stderr, "-n must be at least 1, not %d\n", *n)
+		os.Exit(2)
+	}
+	names := strings.Split(*implNames, ",")
+	for _, name := range names {
+		if _, ok := runs.Lookup(name); !ok {
+			fmt.Fprintf(os.Stderr, "unknown solution %q\n", name)
+			os.Exit(2)
+		}
+	}
+
+	file := defaultFile
+	if fs.NArg() > 0 {
+		file = fs.Arg(0)
+	}
+
+	info, err := os.Stat(file)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	// every run gets its own process so peak RSS and allocations aren't shared between runs
+	exe, err := os.Executable()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	for _, name := range names {
+		var res benchResult
+		for i := range *n {
+			r, err := benchOnce(exe, name, file)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			fmt.Printf("%s %d/%d: %s, %d allocs, %dMB peak RSS, %s CPU\n",
+				name, i+1, *n, r.Wall, r.Allocs, r.PeakRSS>>20, r.CPU)
+
+			res.Wall += r.Wall
+			res.Allocs += r.Allocs
+			res.PeakRSS = max(res.PeakRSS, r.PeakRSS)
+			res.CPU += r.CPU
+		}
+		res.Wall /= time.Duration(*n)
+		res.Allocs /= uint64(*n)
+		res.CPU /= time.Duration(*n)
+
+		row := []string{
+			"", // numbered by appendTimes
+			name,
+			fmt.Sprintf("%.1fs", res.Wall.Seconds()),
+			strconv.FormatUint(res.Allocs, 10),
+			*change,
+			machine(),
+			runtime.GOOS + "/" + runtime.GOARCH,
+			runtime.Version(),
+			commit(),
+			file,
+			strconv.FormatInt(info.Size(), 10),
+			fmt.Sprintf("%dMB", res.PeakRSS>>20),
+			fmt.Sprintf("%.1fs", res.CPU.Seconds()),
+		}
+		if err := appendTimes(*csvPath, row); err != nil {
+			fmt.Fprintf(os.Stderr, "writing %s: %v\n", *csvPath, err)
+			os.Exit(1)
+		}
+	}
+}
+
+// benchOnce runs a solution in a child process with -stats to collect its allocations.
+func benchOnce(exe, name, file string) (benchResult, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command(exe, "-impl", name, "-stats", file)
+	cmd.Stdout = io.Discard
+	cmd.Stderr = &stderr
+
+	start := time.Now()
+	if err := cmd.Run(); err != nil {
+		return benchResult{}, fmt.Errorf("%s: %w\n%s", name, err, stderr.Bytes())
+	}
+	wall := time.Since(start)
+
+	var allocs uint64
+	sc := bufio.NewScanner(&stderr)
+	for sc.Scan() {
+		if v, ok := strings.CutPrefix(sc.Text(), "allocs "); ok {
+			allocs, _ = strconv.ParseUint(v, 10, 64)
+		}
+	}
+
+	return benchResult{
+		Wall:    wall,
+		Allocs:  allocs,
+		PeakRSS: peakRSS(cmd.ProcessState),
+		CPU:     cmd.ProcessState.UserTime() + cmd.ProcessState.SystemTime(),
+	}, nil
+}
+
+// appendTimes appends row to the csv at path, which is created with timesHeader if missing.
+// The Run of row is set to the one after the last row, so it stays a number.
+func appendTimes(path string, row []string) error {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	rows, err := csv.NewReader(f).ReadAll()
+	switch {
+	case err != nil:
+		return err
+	case len(rows) == 0: // new file
+		if err := csv.NewWriter(f).WriteAll([][]string{timesHeader}); err != nil {
+			return err
+		}
+		rows = [][]string{timesHeader}
+	case !slices.Equal(rows[0], timesHeader):
+		return fmt.Errorf("unexpected header %v", rows[0])
+	}
+
+	run := 1
+	if last := rows[len(rows)-1]; len(rows) > 1 {
+		n, err := strconv.Atoi(last[0])
+		if err != nil {
+			return fmt.Errorf("run %q of the last row isn't a number", last[0])
+		}
+		run = n + 1
+	}
+	row[0] = strconv.Itoa(run)
+
+	end, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	// hand edited files might miss the final newline
+	last := make([]byte, 1)
+	if _, err := f.ReadAt(last, end-1); err != nil {
+		return err
+	}
+	if last[0] != '\n' {
+		if _, err := f.Write([]byte{'\n'}); err != nil {
+			return err
+		}
+	}
+
+	w := csv.NewWriter(f)
+	if err := w.Write(row); err != nil {
+		return err
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// machine describes the CPU, falling back to the hostname.
+func machine() string {
+	switch runtime.GOOS {
+	case "linux":
+		if b, err := os.ReadFile("/proc/cpuinfo"); err == nil {
+			for _, line := range strings.Split(string(b), "\n") {
+				if k, v, ok := strings.Cut(line, ":"); ok && strings.TrimSpace(k) == "model name" {
+					return strings.TrimSpace(v)
+				}
+			}
+		}
+	case "darwin":
+		if b, err := exec.Command("sysctl", "-n", "machdep.cpu.brand_string").Output(); err == nil {
+			return strings.TrimSpace(string(b))
+		}
+	}
+
+	host, _ := os.Hostname()
+	return host
+}
+
+// commit returns the VCS revision the binary was built from.
+// `go run` doesn't stamp it so git is asked as fallback.
+func commit() string {
+	if info, ok := debug.ReadBuildInfo(); ok {
+		var rev string
+		var modified bool
+		for _, s := range info.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				rev = s.Value
+			case "vcs.modified":
+				modified = s.Value == "true"
+			}
+		}
+		if rev != "" {
+			if len(rev) > 7 {
+				rev = rev[:7]
+			}
+			if modified {
+				rev += "-dirty"
+			}
+			return rev
+		}
+	}
+
+	out, err := exec.Command("git", "rev-parse", "--short", "HEAD").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
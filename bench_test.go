@@ -0,0 +1,70 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAppendTimes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "times.csv")
+	row := []string{"", "run_9", "1.0s", "42", "a, b", "", "linux/amd64", "go1.23.2", "abc1234", "m.txt", "10", "1MB", "1.0s"}
+
+	for range 2 {
+		if err := appendTimes(path, row); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	b, _ := os.ReadFile(path)
+	lines := strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+	if len(lines) != 3 || lines[0] != strings.Join(timesHeader, ",") {
+		t.Fatalf("unexpected csv:\n%s", b)
+	}
+	if !strings.HasPrefix(lines[1], "1,run_9,") || lines[2] != "2"+lines[1][1:] || !strings.Contains(lines[1], `"a, b"`) {
+		t.Fatalf("unexpected rows:\n%s", b)
+	}
+}
+
+// TestAppendTimesRun checks that the rows of the benchmarks follow the ones of the repo.
+func TestAppendTimesRun(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "times.csv")
+	b, err := os.ReadFile("times.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = os.WriteFile(path, b, 0o644)
+
+	if err := appendTimes(path, make([]string, len(timesHeader))); err != nil {
+		t.Fatal(err)
+	}
+	b, _ = os.ReadFile(path)
+	if lines := strings.Split(strings.TrimSuffix(string(b), "\n"), "\n"); !strings.HasPrefix(lines[len(lines)-1], "10,") {
+		t.Fatalf("unexpected last row %q", lines[len(lines)-1])
+	}
+}
+
+func TestAppendTimesMissingNewline(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "times.csv")
+	header := strings.Join(timesHeader, ",")
+	_ = os.WriteFile(path, []byte(header), 0o644)
+
+	if err := appendTimes(path, make([]string, len(timesHeader))); err != nil {
+		t.Fatal(err)
+	}
+
+	b, _ := os.ReadFile(path)
+	if want := header + "\n1" + strings.Repeat(",", len(timesHeader)-1) + "\n"; string(b) != want {
+		t.Fatalf("got %q, want %q", b, want)
+	}
+}
+
+func TestAppendTimesWrongHeader(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "times.csv")
+	_ = os.WriteFile(path, []byte("Run,s/op,allocs/op,Change\n"), 0o644)
+
+	if err := appendTimes(path, make([]string, len(timesHeader))); err == nil {
+		t.Fatal("expected an error for an outdated header")
+	}
+}
@@ -1,12 +1,14 @@
 package concurrent_1
 
 import (
+	"1brc/parse"
+	"1brc/stats"
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
-	"math"
 	"os"
-	"slices"
 	"sync"
 )
 
@@ -24,16 +26,29 @@ const chunkSize = 16 * MB
 const nConsumer = 25
 const nInBuffer = 25
 
-type city struct {
-	Min   int
-	Max   int
-	Sum   int
-	Count uint
-}
+type city = stats.Station
 
 func Entrypoint(w io.Writer, filepath string) {
+	cities, err := Aggregate(context.Background(), filepath)
+	if err != nil {
+		panic(err)
+	}
+
+	printCities(w, cities)
+}
+
+// Aggregate reads the measurements at filepath.
+// Cancelling ctx stops reading, the consumers skip the chunks still queued,
+// and the cities aggregated so far are returned along with ctx.Err().
+func Aggregate(ctx context.Context, filepath string) (stats.Table, error) {
+	file, err := os.Open(filepath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
 	inChans := make([]chan []byte, nConsumer)
-	outChans := make([]chan map[string]*city, nConsumer)
+	outChans := make([]chan result, nConsumer)
 
 	var wg sync.WaitGroup
 	wg.Add(nConsumer)
@@ -41,38 +56,39 @@ func Entrypoint(w io.Writer, filepath string) {
 	// Create workers
 	for i := range nConsumer {
 		input := make(chan []byte, nInBuffer)
-		output := make(chan map[string]*city, 1)
+		output := make(chan result, 1)
 
-		go consumer(input, output, &wg)
+		go consumer(ctx, input, output, &wg)
 
 		inChans[i] = input
 		outChans[i] = output
 	}
 
 	// read file
-	file, err := os.Open(filepath)
-	if err != nil {
-		panic(err)
-	}
-	defer file.Close()
-
 	chunk := make([]byte, chunkSize)
 	leftover := make([]byte, 110) // should be able to hold the longest possible line
 	leftoverSize := 0
 	iConsumer := 0
 	var n int
 	for {
+		if err = ctx.Err(); err != nil {
+			break
+		}
+
 		n, err = file.Read(chunk)
 		if err == io.EOF {
+			err = nil
 			break
 		}
 		if err != nil {
-			panic(err)
+			break
 		}
 
 		i := bytes.LastIndexByte(chunk[:n], '\n')
-		if i == -1 {
-			i = 0
+		if i == -1 { // no complete line, i.e. the end of a file without final '\n'
+			copy(leftover[leftoverSize:], chunk[:n])
+			leftoverSize += n
+			continue
 		}
 
 		lines := make([]byte, i+leftoverSize)
@@ -82,10 +98,18 @@ func Entrypoint(w io.Writer, filepath string) {
 		copy(leftover, chunk[i+1:n])
 		leftoverSize = n - i - 1
 
-		inChans[iConsumer%nConsumer] <- lines
+		select {
+		case inChans[iConsumer%nConsumer] <- lines:
+		case <-ctx.Done(): // checked at the top of the loop
+		}
 		iConsumer++
 	}
 
+	// last line if the file doesn't end with '\n'
+	if leftoverSize > 0 && err == nil {
+		inChans[iConsumer%nConsumer] <- leftover[:leftoverSize]
+	}
+
 	// stop consumers
 	for i := range nConsumer {
 		close(inChans[i])
@@ -98,34 +122,43 @@ func Entrypoint(w io.Writer, filepath string) {
 	}
 
 	// collect results
-	cities := make(map[string]*city, nMaxCities)
+	cities := make(stats.Table, nMaxCities)
 	for _, outChan := range outChans {
-		for name, v1 := range <-outChan {
-			if v2, ok := cities[name]; ok {
-				v2.Min = min(v1.Min, v2.Min)
-				v2.Max = max(v1.Max, v2.Max)
-				v2.Sum = v1.Sum + v2.Sum
-				v2.Count = v1.Count + v2.Count
-			} else {
-				cities[name] = &city{
-					Min:   v1.Min,
-					Max:   v1.Max,
-					Sum:   v1.Sum,
-					Count: v1.Count,
-				}
-			}
-		}
+		res := <-outChan
+		cities.Merge(res.cities)
+		err = errors.Join(err, res.err)
 	}
 
-	// print
-	printCities(w, cities)
+	return cities, err
+}
+
+// result is what a consumer aggregated, err is set if it stopped at a malformed line.
+type result struct {
+	cities map[string]*city
+	err    error
 }
 
-func consumer(in chan []byte, out chan map[string]*city, wg *sync.WaitGroup) {
+func consumer(ctx context.Context, in chan []byte, out chan result, wg *sync.WaitGroup) {
 	defer wg.Done()
 	cities := make(map[string]*city, 100)
 
+	// a panic can't be recovered by anyone else in this goroutine, so malformed lines are turned into an error here
+	defer func() {
+		var err error
+		if r := recover(); r != nil {
+			err = fmt.Errorf("malformed line: %v", r)
+			for range in {
+				// drain, so the producer isn't blocked
+			}
+		}
+		out <- result{cities, err}
+	}()
+
 	for lines := range in {
+		if ctx.Err() != nil {
+			continue // drain
+		}
+
 		var offset int
 		for offset < len(lines) {
 			used, name, temp := processLine(lines[offset:])
@@ -149,75 +182,21 @@ func consumer(in chan []byte, out chan map[string]*city, wg *sync.WaitGroup) {
 			}
 		}
 	}
-
-	out <- cities
 }
 
 // processLines takes whatever amount of lines and processes the first one.
 // [used] gives the byte length of the first row.
 func processLine(lines []byte) (used int, city string, temp int) {
-	l := bytes.IndexByte(lines, '\n')
+	l := bytes.IndexByte(lines, ';')
 	if l == -1 {
-		l = len(lines)
-	}
-
-	switch {
-	case lines[l-4] == ';': // 1.2
-		return l + 1, string(lines[:l-4]), intTemp(lines[l-3 : l])
-	case lines[l-5] == ';': // 12.3 or -1.2
-		return l + 1, string(lines[:l-5]), intTemp(lines[l-4 : l])
-	case lines[l-6] == ';': // -12.3
-		return l + 1, string(lines[:l-6]), intTemp(lines[l-5 : l])
-	default:
 		panic("unknown format")
 	}
-}
-
-// intTemp converts second part of a line to int.
-// "-77.7" => -777
-// "77.7" => 777
-func intTemp(bs []byte) int {
-	neg := bs[0] == '-'
-	if neg {
-		bs = bs[1:]
-	}
-
-	var res int
-	if bs[1] == '.' {
-		res = int(bs[0]-48)*10 + int(bs[2]-48)
-	} else { // bs[2] == '.'
-		res = int(bs[0]-48)*100 + int(bs[1]-48)*10 + int(bs[3]-48)
-	}
 
-	if neg {
-		return -res
-	}
-	return res
-}
-
-func ceilPrecision1(val float64) float64 {
-	return math.Ceil(val*10) / 10
+	temp, n := parse.Temp(lines[l+1:])
+	return l + n + 2, string(lines[:l]), temp
 }
 
+// printCities writes the cities with the buffered writer of [stats.PrintCities] instead of a fmt call per city.
 func printCities(w io.Writer, cities map[string]*city) {
-	keys := make([]string, 0, len(cities))
-	for k, _ := range cities {
-		keys = append(keys, k)
-	}
-	slices.Sort(keys)
-
-	_, _ = fmt.Fprint(w, "{")
-	for i, key := range keys {
-		c := cities[key]
-		_, _ = fmt.Fprintf(w, "%s=%.1f/%.1f/%.1f",
-			key,
-			ceilPrecision1(float64(c.Min)/10),
-			ceilPrecision1(float64(c.Sum)/10/float64(c.Count)),
-			ceilPrecision1(float64(c.Max)/10),
-		)
-		if i+1 < len(keys) {
-			_, _ = fmt.Fprint(w, ", ")
-		}
-	}
-	_, _ = fmt.Fprint(w, "}\n")
+	stats.PrintCities(w, cities)
 }
@@ -0,0 +1,47 @@
+package concurrent_1
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestAggregateCanceled(t *testing.T) {
+	before := runtime.NumGoroutine()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	cities, err := Aggregate(ctx, "../samples/measurements-20.txt")
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("got error %v, want %v", err, context.Canceled)
+	}
+	if len(cities) != 0 {
+		t.Fatalf("nothing should have been read, got %d cities", len(cities))
+	}
+
+	// all consumers shut down
+	for range 100 {
+		if runtime.NumGoroutine() <= before {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("%d goroutines left running, %d before", runtime.NumGoroutine(), before)
+}
+
+func TestAggregateMalformed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "measurements.txt")
+	if err := os.WriteFile(path, []byte("Hamburg;12.0\nBulawayo;8.9\ngarbage\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// doesn't take the process down with a panic in a consumer
+	if _, err := Aggregate(context.Background(), path); err == nil {
+		t.Fatal("expected an error")
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"1brc/difftest"
+	"1brc/runs"
+	"bytes"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// ==================================================================================== //
+// Differential Test
+// ==================================================================================== //
+// go test -run=TestDifferential -v
+
+// maxReportedDiffs limits the differences reported per solution.
+const maxReportedDiffs = 10
+
+// reference is the simplest solution using integers, all others are compared to it.
+const reference = "run_4"
+
+// floatSums are the solutions summing up floats.
+// Their means may be off by a tenth, see [difftest.DiffWithin].
+var floatSums = map[string]bool{"run_1": true, "run_2": true, "run_3": true}
+
+func TestDifferential(t *testing.T) {
+	tests := []struct {
+		seed     uint64
+		stations int
+		rows     int
+	}{
+		{1, 1, 1_000},
+		{2, 10, 100_000},
+		{3, 413, 100_000},
+		{4, 10_000, 200_000},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("stations=%d,rows=%d", tt.stations, tt.rows), func(t *testing.T) {
+			rng := rand.New(rand.NewPCG(tt.seed, tt.seed))
+
+			path := filepath.Join(t.TempDir(), "measurements.txt")
+			f, err := os.Create(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := difftest.Generate(f, rng, difftest.Names(rng, tt.stations), tt.rows); err != nil {
+				t.Fatal(err)
+			}
+			if err := f.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			differential(t, path)
+		})
+	}
+}
+
+// differential runs every solution on path and reports where they deviate from the reference.
+func differential(t *testing.T, path string) {
+	t.Helper()
+
+	ref, _ := runs.Lookup(reference)
+	var want bytes.Buffer
+	ref.Entrypoint(&want, path)
+
+	for _, impl := range runs.All {
+		if impl.Name == reference {
+			continue
+		}
+
+		var got bytes.Buffer
+		impl.Entrypoint(&got, path)
+
+		reportDiff(t, impl.Name, want.Bytes(), got.Bytes())
+	}
+}
+
+// reportDiff reports which stations and statistics of got differ from want.
+func reportDiff(t *testing.T, name string, want, got []byte) {
+	t.Helper()
+
+	if bytes.Equal(want, got) {
+		return
+	}
+
+	var tolerance float64
+	if floatSums[name] {
+		tolerance = 0.1
+	}
+
+	wantRecords, err := difftest.ParseOutput(want)
+	if err != nil {
+		t.Errorf("%s: expected output: %v", name, err)
+		return
+	}
+	gotRecords, err := difftest.ParseOutput(got)
+	if err != nil {
+		t.Errorf("%s: %v", name, err)
+		return
+	}
+
+	diffs := difftest.DiffWithin(wantRecords, gotRecords, tolerance)
+	if len(diffs) == 0 && tolerance > 0 {
+		return
+	}
+	if len(diffs) == 0 { // e.g. a missing final newline
+		t.Errorf("%s: output differs in formatting only:\n%q\n%q", name, tail(got), tail(want))
+		return
+	}
+
+	t.Errorf("%s: %d differences", name, len(diffs))
+	for _, d := range diffs[:min(len(diffs), maxReportedDiffs)] {
+		t.Errorf("\t%s", d)
+	}
+}
+
+func tail(b []byte) []byte {
+	return b[max(0, len(b)-50):]
+}
@@ -0,0 +1,95 @@
+package difftest
+
+import (
+	"fmt"
+	"math"
+)
+
+// ==================================================================================== //
+// Diff
+// ==================================================================================== //
+
+// Difference is one statistic of one station two outputs disagree on.
+// Stat is "min", "mean", "max", "missing" (only in want), "extra" (only in got) or "order".
+type Difference struct {
+	Station string
+	Stat    string
+	Want    float64
+	Got     float64
+}
+
+func (d Difference) String() string {
+	switch d.Stat {
+	case "missing", "extra", "order":
+		return fmt.Sprintf("%q: %s", d.Station, d.Stat)
+	default:
+		return fmt.Sprintf("%q: %s is %.1f, want %.1f", d.Station, d.Stat, d.Got, d.Want)
+	}
+}
+
+// Diff compares two parsed outputs station by station.
+func Diff(want, got []Record) []Difference {
+	return DiffWithin(want, got, 0)
+}
+
+// DiffWithin is like [Diff] but accepts means which are off by at most meanTolerance.
+// Solutions summing floats accumulate rounding errors, which can change the rounded mean by one tenth.
+func DiffWithin(want, got []Record, meanTolerance float64) []Difference {
+	var diffs []Difference
+
+	gotByName := make(map[string]Record, len(got))
+	for _, r := range got {
+		gotByName[r.Name] = r
+	}
+	wantByName := make(map[string]Record, len(want))
+	for _, w := range want {
+		wantByName[w.Name] = w
+
+		g, ok := gotByName[w.Name]
+		if !ok {
+			diffs = append(diffs, Difference{Station: w.Name, Stat: "missing"})
+			continue
+		}
+
+		for _, s := range []struct {
+			stat      string
+			want, got float64
+			tolerance float64
+		}{
+			{"min", w.Min, g.Min, 0},
+			{"mean", w.Mean, g.Mean, meanTolerance},
+			{"max", w.Max, g.Max, 0},
+		} {
+			if s.tolerance > 0 {
+				// 1e-9 as the parsed values are not exact either
+				if math.Abs(s.want-s.got) > s.tolerance+1e-9 {
+					diffs = append(diffs, Difference{Station: w.Name, Stat: s.stat, Want: s.want, Got: s.got})
+				}
+				continue
+			}
+
+			// also catches -0.0 vs 0.0
+			if s.want != s.got || math.Signbit(s.want) != math.Signbit(s.got) {
+				diffs = append(diffs, Difference{Station: w.Name, Stat: s.stat, Want: s.want, Got: s.got})
+			}
+		}
+	}
+
+	for _, g := range got {
+		if _, ok := wantByName[g.Name]; !ok {
+			diffs = append(diffs, Difference{Station: g.Name, Stat: "extra"})
+		}
+	}
+
+	// only worth reporting if the stations are the same
+	if len(diffs) == 0 {
+		for i := range want {
+			if want[i].Name != got[i].Name {
+				diffs = append(diffs, Difference{Station: got[i].Name, Stat: "order"})
+				break
+			}
+		}
+	}
+
+	return diffs
+}
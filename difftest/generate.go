@@ -0,0 +1,94 @@
+package difftest
+
+import (
+	"bufio"
+	"io"
+	"math/rand/v2"
+	"strconv"
+	"unicode/utf8"
+)
+
+// ==================================================================================== //
+// Generate
+// ==================================================================================== //
+
+// MaxNameLength is the longest station name in bytes allowed by the challenge.
+const MaxNameLength = 100
+
+// runeRanges are picked from when generating names, so names contain
+// 1 byte (ASCII), 2 byte (Latin-1, Cyrillic), 3 byte (CJK) and 4 byte (emoji) runes.
+var runeRanges = [][2]rune{
+	{' ', '~'},
+	{'À', 'ÿ'},
+	{'А', 'я'},
+	{'一', '龥'},
+	{'😀', '🙏'},
+}
+
+// Name returns a random valid UTF-8 station name of 1 to maxLen bytes.
+// Names never contain ';', '\n' or '=', the latter to keep the output unambiguous.
+func Name(rng *rand.Rand, maxLen int) string {
+	l := 1 + rng.IntN(maxLen)
+
+	b := make([]byte, 0, l)
+	for {
+		r := runeRanges[rng.IntN(len(runeRanges))]
+		c := r[0] + rng.Int32N(r[1]-r[0]+1)
+		if c == ';' || c == '=' {
+			continue
+		}
+		if len(b)+utf8.RuneLen(c) > l {
+			break
+		}
+		b = utf8.AppendRune(b, c)
+	}
+
+	if len(b) == 0 {
+		return "x"
+	}
+	return string(b)
+}
+
+// Names returns n unique random station names.
+func Names(rng *rand.Rand, n int) []string {
+	seen := make(map[string]bool, n)
+	names := make([]string, 0, n)
+	for len(names) < n {
+		name := Name(rng, MaxNameLength)
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// AppendTemp appends a random temperature between -99.9 and 99.9 with one fractional digit.
+func AppendTemp(b []byte, rng *rand.Rand) []byte {
+	t := rng.IntN(1999) - 999
+	if t < 0 {
+		b = append(b, '-')
+		t = -t
+	}
+	b = strconv.AppendInt(b, int64(t/10), 10)
+	return append(b, '.', byte('0'+t%10))
+}
+
+// Generate writes rows random measurements of the given stations to w.
+func Generate(w io.Writer, rng *rand.Rand, stations []string, rows int) error {
+	bw := bufio.NewWriter(w)
+
+	line := make([]byte, 0, MaxNameLength+8)
+	for range rows {
+		line = append(line[:0], stations[rng.IntN(len(stations))]...)
+		line = append(line, ';')
+		line = AppendTemp(line, rng)
+		line = append(line, '\n')
+
+		if _, err := bw.Write(line); err != nil {
+			return err
+		}
+	}
+
+	return bw.Flush()
+}
@@ -0,0 +1,52 @@
+package difftest
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// ==================================================================================== //
+// Output
+// ==================================================================================== //
+
+// Record is one station of the output "{name=min/mean/max, ...}".
+type Record struct {
+	Name string
+	Min  float64
+	Mean float64
+	Max  float64
+}
+
+// stats matches the end of a record, so names may contain ", " themselves.
+var stats = regexp.MustCompile(`=(-?\d+\.\d)/(-?\d+\.\d)/(-?\d+\.\d)(, |}\n?$)`)
+
+// ParseOutput parses the output of a solution into records in output order.
+func ParseOutput(out []byte) ([]Record, error) {
+	body, ok := bytes.CutPrefix(out, []byte("{"))
+	if !ok {
+		return nil, fmt.Errorf("output does not start with '{': %.20q", out)
+	}
+	if string(body) == "}\n" || string(body) == "}" {
+		return nil, nil
+	}
+
+	var records []Record
+	for len(body) > 0 {
+		m := stats.FindSubmatchIndex(body)
+		if m == nil {
+			return nil, fmt.Errorf("malformed output after %d records: %.50q", len(records), body)
+		}
+
+		r := Record{Name: string(body[:m[0]])}
+		r.Min, _ = strconv.ParseFloat(string(body[m[2]:m[3]]), 64)
+		r.Mean, _ = strconv.ParseFloat(string(body[m[4]:m[5]]), 64)
+		r.Max, _ = strconv.ParseFloat(string(body[m[6]:m[7]]), 64)
+		records = append(records, r)
+
+		body = body[m[1]:]
+	}
+
+	return records, nil
+}
@@ -0,0 +1,45 @@
+package difftest
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseOutput(t *testing.T) {
+	records, err := ParseOutput([]byte("{Abha=-23.0/18.0/59.2, Cabo San Lucas=14.9/14.9/14.9, a, b=-0.0/0.1/0.2}\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Record{
+		{"Abha", -23.0, 18.0, 59.2},
+		{"Cabo San Lucas", 14.9, 14.9, 14.9},
+		{"a, b", 0, 0.1, 0.2},
+	}
+	if !reflect.DeepEqual(records, want) {
+		t.Fatalf("got %v, want %v", records, want)
+	}
+
+	if records, err := ParseOutput([]byte("{}\n")); err != nil || len(records) != 0 {
+		t.Fatalf("empty output: %v, %v", records, err)
+	}
+
+	if _, err := ParseOutput([]byte("{Abha=-23.0/18.0, ")); err == nil {
+		t.Fatal("expected an error for malformed output")
+	}
+}
+
+func TestDiff(t *testing.T) {
+	want := []Record{{"a", 1, 2, 3}, {"b", 1, 2, 3}}
+	got := []Record{{"a", 1, 2.1, 3}, {"c", 1, 2, 3}}
+
+	diffs := Diff(want, got)
+	expected := []Difference{
+		{Station: "a", Stat: "mean", Want: 2, Got: 2.1},
+		{Station: "b", Stat: "missing"},
+		{Station: "c", Stat: "extra"},
+	}
+	if !reflect.DeepEqual(diffs, expected) {
+		t.Fatalf("got %v, want %v", diffs, expected)
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"1brc/concurrent_1"
+	"1brc/difftest"
+	"1brc/run_9"
+	"bufio"
+	"bytes"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// ==================================================================================== //
+// Fuzz
+// ==================================================================================== //
+// go test -run=XXX -fuzz=FuzzPipeline
+
+// chunkSize and maxLineLength as in run_9 and concurrent_1.
+const (
+	chunkSize     = 16 * MB
+	maxLineLength = 110
+)
+
+// FuzzPipeline generates measurement files with a line starting delta bytes away from chunkSize,
+// so the first refill of run_9 and the first chunk of concurrent_1 split random lines.
+func FuzzPipeline(f *testing.F) {
+	for _, delta := range []int16{-maxLineLength, -7, -1, 0, 1, 3, maxLineLength} {
+		f.Add(uint64(delta)+1, uint16(10), delta, uint8(20), true)
+	}
+	f.Add(uint64(42), uint16(10_000), int16(0), uint8(0), true)  // EOF at chunkSize
+	f.Add(uint64(43), uint16(1), int16(-3), uint8(1), false)     // missing final newline
+	f.Add(uint64(44), uint16(500), int16(50), uint8(255), false) // missing final newline after the boundary
+
+	f.Fuzz(func(t *testing.T, seed uint64, stations uint16, delta int16, tailRows uint8, finalNewline bool) {
+		if stations == 0 || stations > 10_000 || delta < -maxLineLength || delta > maxLineLength {
+			t.Skip()
+		}
+
+		rng := rand.New(rand.NewPCG(seed, seed))
+		names := difftest.Names(rng, int(stations))
+
+		path := filepath.Join(t.TempDir(), "measurements.txt")
+		b := generateBoundary(rng, names, chunkSize+int(delta), int(tailRows))
+		if !finalNewline {
+			b = bytes.TrimSuffix(b, []byte("\n"))
+		}
+		if err := os.WriteFile(path, b, 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		want := referenceOutput(b)
+
+		var got bytes.Buffer
+		run_9.Entrypoint(&got, path)
+		reportDiff(t, "run_9", want, got.Bytes())
+
+		got.Reset()
+		concurrent_1.Entrypoint(&got, path)
+		reportDiff(t, "concurrent_1", want, got.Bytes())
+	})
+}
+
+// generateBoundary generates random lines such that one starts exactly at offset,
+// followed by tailRows more lines.
+func generateBoundary(rng *rand.Rand, names []string, offset int, tailRows int) []byte {
+	var block bytes.Buffer
+	_ = difftest.Generate(&block, rng, names, 1_000)
+
+	b := make([]byte, 0, offset+(tailRows+1)*maxLineLength)
+	for len(b)+block.Len() < offset-3*maxLineLength {
+		b = append(b, block.Bytes()...)
+	}
+
+	// random lines until close to offset
+	sc := bufio.NewScanner(&block)
+	for len(b) < offset-3*maxLineLength && sc.Scan() {
+		b = append(b, sc.Bytes()...)
+		b = append(b, '\n')
+	}
+
+	// padding lines of 6 ("p;0.0\n") to 105 bytes to land exactly on offset
+	for gap := offset - len(b); gap > 0; gap = offset - len(b) {
+		l := gap
+		if l > 105 {
+			l = min(105, gap-6)
+		}
+		b = append(b, strings.Repeat("p", l-5)...)
+		b = append(b, ";0.0\n"...)
+	}
+
+	line := make([]byte, 0, maxLineLength)
+	for range tailRows + 1 {
+		line = append(line[:0], names[rng.IntN(len(names))]...)
+		line = append(line, ';')
+		line = difftest.AppendTemp(line, rng)
+		b = append(append(b, line...), '\n')
+	}
+
+	return b
+}
+
+// referenceOutput is the trivially correct solution the others are checked against.
+// It formats the results the same way as printCities does.
+func referenceOutput(measurements []byte) []byte {
+	type stats struct{ min, max, sum, count int }
+	stations := make(map[string]*stats)
+
+	for _, line := range strings.Split(strings.TrimSuffix(string(measurements), "\n"), "\n") {
+		i := strings.LastIndexByte(line, ';')
+		f, err := strconv.ParseFloat(line[i+1:], 64)
+		if err != nil {
+			panic(err)
+		}
+		temp := int(math.Round(f * 10))
+
+		s, ok := stations[line[:i]]
+		if !ok {
+			s = &stats{min: temp, max: temp}
+			stations[line[:i]] = s
+		}
+		s.min = min(s.min, temp)
+		s.max = max(s.max, temp)
+		s.sum += temp
+		s.count++
+	}
+
+	names := make([]string, 0, len(stations))
+	for name := range stations {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	ceil := func(val float64) float64 { return math.Ceil(val*10) / 10 }
+
+	var out bytes.Buffer
+	out.WriteString("{")
+	for i, name := range names {
+		s := stations[name]
+		if i > 0 {
+			out.WriteString(", ")
+		}
+		fmt.Fprintf(&out, "%s=%.1f/%.1f/%.1f", name,
+			ceil(float64(s.min)/10),
+			ceil(float64(s.sum)/10/float64(s.count)),
+			ceil(float64(s.max)/10),
+		)
+	}
+	out.WriteString("}\n")
+	return out.Bytes()
+}
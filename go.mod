@@ -1,3 +1,5 @@
 module 1brc
 
 go 1.23.2
+
+require golang.org/x/text v0.28.0
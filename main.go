@@ -1,17 +1,412 @@
 package main
 
 import (
+	"1brc/parse"
 	"1brc/run_9"
+	"1brc/runs"
+	"1brc/stats"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
+	"maps"
 	"os"
+	"os/signal"
+	"runtime"
+	"slices"
+	"strings"
 	"time"
 )
 
+const defaultFile = "measurements_1b.txt"
+
+// usage:
+//
+//	1brc [-impl run_9] [-format classic|json|prometheus] [-bucket minute|hour|day] [-groups file] [-top 10|-bottom 10 [-by mean|min|max|count|range]] [-sort name|collate:de|max|-max] [-include rule]... [-exclude rule]... [-input-unit C|F|K] [-unit C|F|K] [-digits 1] [-output-digits 1] [-wide] [-sep ,] [-station-field 1] [-temp-field 2] [-quoted] [-nfc] [-fold] [-trim] [-progress 1s] [-timeout 10s] [-partial] [-follow] [-snapshot 1s] [-checkpoint file [-resume]] [-cpuprofile cpu.prof] [-memprofile mem.prof] [-trace trace.out] [-blockprofile block.prof] [file]
+//	1brc bench [-impl run_8,run_9] [-n 3] [-csv times.csv] [-change "..."] [file]
+//	1brc serve [-addr :8080] [-max-body 1073741824] [-max-stations 10000]
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "bench" {
+		bench(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "serve" {
+		serve(os.Args[2:])
+		return
+	}
+
+	run(os.Args[1:])
+}
+
+func run(args []string) {
+	fs := flag.NewFlagSet("1brc", flag.ExitOnError)
+	implName := fs.String("impl", "run_9", "solution to run, one of "+strings.Join(runs.Names(), ", "))
+	format := fs.String("format", "classic", "output `format`: classic, json or prometheus, only classic for solutions other than run_9 and concurrent_1")
+	bucket := fs.String("bucket", "", "aggregate lines \"[timestamp;]station;temp\" per `minute, hour or day`, only supported by run_9")
+	groupsFile := fs.String("groups", "", "also print the stations rolled up to the groups of `file` with lines \"station;group\", the others in \"(ungrouped)\"")
+	sel := selection{conv: challenge}
+	fs.IntVar(&sel.top, "top", 0, "only print the `k` stations with the highest -by")
+	fs.IntVar(&sel.bottom, "bottom", 0, "only print the `k` stations with the lowest -by")
+	by := fs.String("by", "mean", "statistic for -top and -bottom: mean, min, max, count or range")
+	fs.Func("sort", "`order` of the output: name in byte order (default), collate:<language> e.g. collate:de, or a statistic like max, prefixed by - for the reverse", func(s string) (err error) {
+		sel.order, err = stats.ParseOrder(s)
+		return err
+	})
+	fs.Func("input-unit", "`unit` of the measurements: C (default), F or K", func(s string) (err error) {
+		sel.conv.From, err = stats.ParseUnit(s)
+		return err
+	})
+	fs.Func("unit", "convert the temperatures to `unit` C, F or K", func(s string) (err error) {
+		sel.conv.To, err = stats.ParseUnit(s)
+		return err
+	})
+	fs.IntVar(&sel.conv.Digits, "digits", 1, "fractional `digits` of the temperatures, 0 to 3, only supported by run_9")
+	fs.IntVar(&sel.conv.OutputDigits, "output-digits", 1, "fractional `digits` of the output, 0 to 3")
+	wide := fs.Bool("wide", false, "allow temperatures beyond -99.9..99.9, only supported by run_9")
+	sep := fs.String("sep", "", "field `separator` instead of ';', e.g. ',', '|' or '\\t', only supported by run_9")
+	stationField := fs.Int("station-field", 0, "`position` of the station in a line starting at 1, only supported by run_9")
+	tempField := fs.Int("temp-field", 0, "`position` of the temperature in a line starting at 1, only supported by run_9")
+	quoted := fs.Bool("quoted", false, `allow station names quoted as in CSV, e.g. "Washington; DC", only supported by run_9`)
+	var normalization stats.Normalization
+	fs.BoolVar(&normalization.NFC, "nfc", false, "merge station names in different Unicode normalization forms, only supported by run_9")
+	fs.BoolVar(&normalization.Fold, "fold", false, "merge station names differing in case, only supported by run_9")
+	fs.BoolVar(&normalization.Trim, "trim", false, "merge station names differing in leading and trailing white space, only supported by run_9")
+	var filter stats.Filter
+	const ruleUsage = " stations matching `rule` name:Hamburg, prefix:Ham, regexp:^Ham or file:stations.txt with one name per line, repeatable, only supported by run_9"
+	fs.Func("include", "only aggregate"+ruleUsage, filter.Include.Add)
+	fs.Func("exclude", "don't aggregate"+ruleUsage, filter.Exclude.Add)
+	allocStats := fs.Bool("stats", false, "print the number of allocations to stderr")
+	progress := fs.Duration("progress", 0, "print the progress to stderr every `interval`, only supported by run_9")
+	timeout := fs.Duration("timeout", 0, "stop after `duration`, only supported by run_9 and concurrent_1")
+	partial := fs.Bool("partial", false, "print the stations aggregated so far when stopped by -timeout or an interrupt")
+	follow := fs.Bool("follow", false, "keep reading the file as it grows until interrupted, only supported by run_9")
+	snapshot := fs.Duration("snapshot", time.Second, "print the stations every `interval` with -follow")
+	checkpoint := fs.String("checkpoint", "", "periodically write the progress to `file` to be able to -resume, only supported by run_9")
+	checkpointInterval := fs.Duration("checkpoint-interval", 10*time.Second, "write the -checkpoint every `interval`")
+	resume := fs.Bool("resume", false, "continue from -checkpoint if it exists")
+	var profiles profileFlags
+	profiles.register(fs)
+	_ = fs.Parse(args)
+
+	impl, ok := runs.Lookup(*implName)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown solution %q\n", *implName)
+		os.Exit(2)
+	}
+
+	file := defaultFile
+	if fs.NArg() > 0 {
+		file = fs.Arg(0)
+	}
+
+	var err error
+	write, ok := formats[*format]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown format %q\n", *format)
+		os.Exit(2)
+	}
+	if sel.by, err = stats.ParseStat(*by); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if err = sel.check(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	var groups map[string]string
+	if *groupsFile != "" {
+		if *format == "prometheus" || *bucket != "" {
+			fmt.Fprintln(os.Stderr, "-groups is not supported with -format prometheus and -bucket")
+			os.Exit(2)
+		}
+		var f *os.File
+		f, err = os.Open(*groupsFile)
+		if err == nil {
+			groups, err = stats.ReadGroups(f)
+			f.Close()
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "reading groups: %v\n", err)
+			os.Exit(2)
+		}
+	}
+
+	// printTables writes the stations and, with -groups, the groups afterwards,
+	// as JSON both in a single object {"stations": [...], "groups": [...]}
+	printTables := func(t stats.Table) {
+		var err error
+		switch {
+		case groups == nil:
+			err = write(os.Stdout, sel.records(t))
+		case *format == "json":
+			err = json.NewEncoder(os.Stdout).Encode(struct {
+				Stations []stats.Record `json:"stations"`
+				Groups   []stats.Record `json:"groups"`
+			}{sel.records(t), sel.records(t.RollUp(groups))})
+		default:
+			err = write(os.Stdout, sel.records(t))
+			if err == nil {
+				err = write(os.Stdout, sel.records(t.RollUp(groups)))
+			}
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+	}
+
+	var opts run_9.Options
+	var custom bool // any option set
+	if *progress > 0 {
+		opts.Progress = func(p run_9.Progress) { fmt.Fprintln(os.Stderr, p) }
+		opts.ProgressInterval = *progress
+		custom = true
+	}
+	if *follow {
+		opts.Follow = true
+		opts.Snapshot = printTables
+		opts.SnapshotInterval = *snapshot
+		custom = true
+	}
+	if *checkpoint != "" {
+		opts.Checkpoint = *checkpoint
+		opts.CheckpointInterval = *checkpointInterval
+		opts.Resume = *resume
+		// what ParseTemp and Normalize do, as a checkpoint can only be resumed with the same
+		opts.CheckpointKey = fmt.Sprintf("digits=%d %+v", sel.conv.Digits, normalization)
+		custom = true
+	} else if *resume {
+		fmt.Fprintln(os.Stderr, "-resume requires -checkpoint")
+		os.Exit(2)
+	}
+	if d, o := sel.conv.Digits, sel.conv.OutputDigits; d < 0 || d > 3 || o < 0 || o > 3 {
+		fmt.Fprintln(os.Stderr, "-digits and -output-digits must be 0 to 3")
+		os.Exit(2)
+	}
+	if d := sel.conv.Digits; d != 1 {
+		opts.ParseTemp = func(b []byte) (int, int, bool) { return parse.Fixed(b, d) }
+		custom = true
+	}
+	if *wide {
+		opts.WideRange = true
+		custom = true
+	}
+	if *sep != "" || *stationField != 0 || *tempField != 0 {
+		if *sep == `\t` {
+			*sep = "\t"
+		}
+		if len(*sep) > 1 {
+			fmt.Fprintf(os.Stderr, "separator %q is more than one byte\n", *sep)
+			os.Exit(2)
+		}
+		if *sep != "" {
+			opts.Separator = (*sep)[0]
+		}
+		opts.StationField, opts.TempField = *stationField, *tempField
+		custom = true
+	}
+	if *quoted {
+		opts.Quoted = true
+		custom = true
+	}
+	if !filter.Empty() {
+		opts.Filter = &filter
+		custom = true
+	}
+	if !normalization.Empty() {
+		opts.Normalize = normalization.Apply
+		custom = true
+	}
+	if custom && impl.Name != "run_9" {
+		fmt.Fprintf(os.Stderr, "options are only supported by run_9, not %s\n", impl.Name)
+		os.Exit(2)
+	}
+
+	var window time.Duration
+	if *bucket != "" {
+		if impl.Name != "run_9" || *format == "prometheus" || *follow || *checkpoint != "" || opts.Separator != 0 || opts.StationField != 0 || opts.TempField != 0 {
+			fmt.Fprintln(os.Stderr, "-bucket is only supported by run_9 without -follow, -checkpoint, -format prometheus, -sep, -station-field and -temp-field")
+			os.Exit(2)
+		}
+		if window, ok = buckets[*bucket]; !ok {
+			fmt.Fprintf(os.Stderr, "unknown bucket %q\n", *bucket)
+			os.Exit(2)
+		}
+	}
+
+	// tables turns the result of aggregating into a func printing it, nil if there is no result
+	tables := func(aggregate func(ctx context.Context, file string) (stats.Table, error)) func(ctx context.Context, file string) (func(), error) {
+		return func(ctx context.Context, file string) (func(), error) {
+			cities, err := aggregate(ctx, file)
+			if cities == nil {
+				return nil, err
+			}
+			return func() { printTables(cities) }, err
+		}
+	}
+
+	// nil for solutions which can't be stopped early
+	var aggregate func(ctx context.Context, file string) (printResult func(), err error)
+	switch {
+	case window > 0:
+		aggregate = func(ctx context.Context, file string) (func(), error) {
+			windows, err := run_9.AggregateWindows(ctx, file, window, opts)
+			if windows == nil {
+				return nil, err
+			}
+			return func() { printWindows(*format, sel, windows) }, err
+		}
+	case impl.Name == "run_9":
+		aggregate = tables(func(ctx context.Context, file string) (stats.Table, error) {
+			return run_9.Aggregate(ctx, file, opts)
+		})
+	case impl.Aggregate != nil:
+		aggregate = tables(impl.Aggregate)
+	}
+	if aggregate == nil && (*timeout > 0 || *partial || *format != "classic" || groups != nil || sel != (selection{conv: challenge})) {
+		fmt.Fprintf(os.Stderr, "-timeout, -partial, -format, -groups, -top and -bottom are only supported by run_9 and concurrent_1, not %s\n", impl.Name)
+		os.Exit(2)
+	}
+
+	var before runtime.MemStats
+	runtime.ReadMemStats(&before)
+	stopProfiles := profiles.start()
 	start := time.Now()
 
-	run_9.Entrypoint(os.Stdout, "measurements_1b.txt")
+	exitCode := 0
+	if aggregate != nil {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		if *timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, *timeout)
+			defer cancel()
+		}
+
+		printResult, err := aggregate(ctx, file)
+		switch {
+		case err == nil, *follow && ctx.Err() != nil: // following only ends by an interrupt or timeout
+			printResult()
+		case *partial && printResult != nil:
+			fmt.Fprintf(os.Stderr, "%v, partial results:\n", err)
+			printResult()
+			exitCode = 1
+		default:
+			fmt.Fprintln(os.Stderr, err)
+			exitCode = 1
+		}
+	} else {
+		impl.Entrypoint(os.Stdout, file)
+	}
 
 	elapsed := time.Since(start)
-	fmt.Printf("took %s\n", elapsed)
+	stopProfiles()
+	if *format == "classic" {
+		fmt.Printf("took %s\n", elapsed)
+	} else { // keep stdout parsable
+		fmt.Fprintf(os.Stderr, "took %s\n", elapsed)
+	}
+
+	if *allocStats {
+		var after runtime.MemStats
+		runtime.ReadMemStats(&after)
+		fmt.Fprintf(os.Stderr, "allocs %d\n", after.Mallocs-before.Mallocs)
+	}
+
+	os.Exit(exitCode)
+}
+
+// formats are the writers selectable by -format.
+var formats = map[string]func(w io.Writer, records []stats.Record) error{
+	"classic": stats.PrintRecords,
+	"json":    stats.WriteJSON,
+	"prometheus": func(w io.Writer, records []stats.Record) error {
+		c := stats.Counters{RowsOnly: true} // bytes and parse errors are only counted by serve
+		for _, r := range records {
+			c.Rows += uint64(r.Count)
+		}
+		return stats.WritePrometheus(w, records, c)
+	},
+}
+
+// selection picks the stations to output, by default all ordered by name, orders and converts them.
+type selection struct {
+	top, bottom int
+	by          stats.Stat
+	order       stats.Order // if not set by name in byte order, or by rank for top and bottom
+
+	conv stats.Conversion // challenge if not set
+}
+
+// challenge are the tenths of a degree Celsius of the challenge which don't need to be converted.
+var challenge = stats.Conversion{Digits: 1, OutputDigits: 1}
+
+// check returns an error for a negative top or bottom or both of them, which aren't silently taken for all or top.
+func (s selection) check() error {
+	switch {
+	case s.top < 0 || s.bottom < 0:
+		return errors.New("top and bottom must be positive")
+	case s.top > 0 && s.bottom > 0:
+		return errors.New("only one of top and bottom")
+	}
+	return nil
+}
+
+func (s selection) records(t stats.Table) []stats.Record {
+	var records []stats.Record
+	switch {
+	case s.top > 0:
+		records = t.Top(s.top, s.by)
+	case s.bottom > 0:
+		records = t.Bottom(s.bottom, s.by)
+	default:
+		records = t.Records()
+	}
+	if s.order != (stats.Order{}) {
+		s.order.Sort(records)
+	}
+
+	if s.conv != challenge {
+		conv := s.conv
+		conv.To = cmp.Or(conv.To, conv.From) // the input unit if no other is asked for
+		records = stats.Convert(records, conv)
+	}
+	return records
+}
+
+// buckets are the windows selectable by -bucket.
+var buckets = map[string]time.Duration{
+	"minute": time.Minute,
+	"hour":   time.Hour,
+	"day":    24 * time.Hour,
+}
+
+// printWindows prints a line per bucket starting with its time, or "none" for the lines without a timestamp, for the classic format,
+// or a single JSON object with the time of the buckets as keys.
+func printWindows(format string, sel selection, windows map[time.Time]stats.Table) {
+	name := func(bucket time.Time) string {
+		if bucket.IsZero() { // run_9.NoBucket
+			return "none"
+		}
+		return bucket.Format(time.RFC3339)
+	}
+
+	if format == "json" {
+		records := make(map[string][]stats.Record, len(windows))
+		for bucket, t := range windows {
+			records[name(bucket)] = sel.records(t)
+		}
+		if err := json.NewEncoder(os.Stdout).Encode(records); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		return
+	}
+
+	for _, bucket := range slices.SortedFunc(maps.Keys(windows), time.Time.Compare) {
+		fmt.Print(name(bucket), " ")
+		_ = stats.PrintRecords(os.Stdout, sel.records(windows[bucket]))
+	}
 }
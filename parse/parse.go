@@ -0,0 +1,128 @@
+package parse
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// ==================================================================================== //
+// Temperature
+// ==================================================================================== //
+
+// Temp parses the temperature at the start of b into tenths of a degree
+// and returns the number of bytes the temperature takes up, i.e. the
+// position of the '\n' terminating a line.
+// "-77.7\n" => -777, 5
+// "1.2\n" => 12, 3
+//
+// All legal forms (d.d, dd.d, -d.d, -dd.d) are handled without branching on the
+// input: the position of '.' is found via the 4th bit which is set for every
+// digit but not for '.', the digits are shifted into place and combined with
+// a single multiplication.
+//
+// Only the first 8 bytes of b are looked at, if b is shorter it is padded with
+// zeros. The result for anything else than a legal temperature is undefined.
+func Temp(b []byte) (temp int, n int) {
+	var word uint64
+	if len(b) >= 8 {
+		word = binary.LittleEndian.Uint64(b)
+	} else {
+		var buf [8]byte
+		copy(buf[:], b)
+		word = binary.LittleEndian.Uint64(buf[:])
+	}
+
+	// bit position of '.', which is either at byte 1, 2 or 3
+	dot := bits.TrailingZeros64(^word & 0x10101000)
+
+	// -1 if the first byte is '-' (4th bit not set), 0 otherwise
+	sign := int64(^word<<59) >> 63
+	// clears the '-' but keeps a possible digit
+	word &= ^uint64(sign & 0xFF)
+
+	// move '.' to byte 3, so the digits end up in byte 1 (tens), 2 (ones) and 4 (tenths)
+	digits := (word << (28 - dot)) & 0x0F000F0F00
+	// 100*tens + 10*ones + tenths accumulate in bits 32 to 42
+	abs := int64((digits * 0x640a0001) >> 32 & 0x3FF)
+
+	return int((abs ^ sign) - sign), dot>>3 + 2
+}
+
+// Valid reports if b is exactly one of the legal forms d.d, dd.d, -d.d or -dd.d,
+// i.e. if [Temp] can be used on input which wasn't checked before.
+func Valid(b []byte) bool {
+	if len(b) > 0 && b[0] == '-' {
+		b = b[1:]
+	}
+	if len(b) < 3 || len(b) > 4 || b[len(b)-2] != '.' {
+		return false
+	}
+	for i, c := range b {
+		if i != len(b)-2 && (c < '0' || c > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// TempWide is [Temp] for temperatures beyond -99.9..99.9 with one fractional digit.
+// The legal forms of the challenge take the fast path, everything else is handed to [Fixed].
+// Like Fixed it checks the input, ok is false for anything Fixed rejects as well.
+// Unlike Temp it doesn't read past the number for temperatures with 3 or more integer digits.
+func TempWide(b []byte) (temp int, n int, ok bool) {
+	if len(b) >= 4 && (b[1] == '.' && b[0] != '-' || b[2] == '.' || b[3] == '.' && b[0] == '-') {
+		if temp, n = Temp(b); (n == len(b) || n < len(b) && b[n] == '\n') && Valid(b[:n]) {
+			return temp, n, true
+		}
+	}
+	return Fixed(b, 1)
+}
+
+// ==================================================================================== //
+// Fixed Point
+// ==================================================================================== //
+
+// maxIntDigits keeps the result of [Fixed] from overflowing
+const maxIntDigits = 15
+
+// Fixed parses a number with up to 15 integer digits and exactly digits fractional digits followed by '\n'
+// or the end of b, e.g. "-273.15\n" with 2 digits => -27315, 7. Without fractional digits there is no '.'.
+// Unlike [Temp] it checks the input and ok is false for anything else, it's also a lot slower.
+func Fixed(b []byte, digits int) (v int, n int, ok bool) {
+	i := 0
+	neg := len(b) > 0 && b[0] == '-'
+	if neg {
+		i++
+	}
+
+	start := i
+	for i < len(b) && i-start <= maxIntDigits && b[i] >= '0' && b[i] <= '9' {
+		v = v*10 + int(b[i]-'0')
+		i++
+	}
+	if i == start || i-start > maxIntDigits {
+		return 0, i, false
+	}
+
+	if digits > 0 {
+		if i >= len(b) || b[i] != '.' {
+			return 0, i, false
+		}
+		i++
+		for range digits {
+			if i >= len(b) || b[i] < '0' || b[i] > '9' {
+				return 0, i, false
+			}
+			v = v*10 + int(b[i]-'0')
+			i++
+		}
+	}
+
+	if i < len(b) && b[i] != '\n' {
+		return 0, i, false
+	}
+	if neg {
+		v = -v
+	}
+	return v, i, true
+}
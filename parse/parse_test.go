@@ -0,0 +1,157 @@
+package parse
+
+import (
+	"math"
+	"strconv"
+	"testing"
+)
+
+func TestTemp(t *testing.T) {
+	tests := []struct {
+		in   string
+		temp int
+		n    int
+	}{
+		{"0.0", 0, 3},
+		{"-0.0", 0, 4},
+		{"1.2\n", 12, 3},
+		{"-1.2\n", -12, 4},
+		{"12.3\nMünchen;1.0", 123, 4},
+		{"-12.3\nMünchen;1.0", -123, 5},
+		{"99.9", 999, 4},
+		{"-99.9", -999, 5},
+		{"05.5", 55, 4},
+	}
+
+	for _, tt := range tests {
+		temp, n := Temp([]byte(tt.in))
+		if temp != tt.temp || n != tt.n {
+			t.Errorf("Temp(%q) = %d, %d; want %d, %d", tt.in, temp, n, tt.temp, tt.n)
+		}
+	}
+}
+
+// go test -run=XXX -fuzz=FuzzTemp ./parse
+func FuzzTemp(f *testing.F) {
+	for _, seed := range []string{"0.0", "1.2", "-1.2", "12.3", "-12.3", "99.9", "-99.9"} {
+		f.Add(seed, "\n")
+	}
+
+	f.Fuzz(func(t *testing.T, s string, rest string) {
+		if !Valid([]byte(s)) {
+			t.Skip()
+		}
+
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			t.Fatalf("strconv.ParseFloat(%q): %v", s, err)
+		}
+		want := int(math.Round(f * 10))
+
+		temp, n := Temp([]byte(s + "\n" + rest))
+		if temp != want || n != len(s) {
+			t.Errorf("Temp(%q) = %d, %d; want %d, %d", s, temp, n, want, len(s))
+		}
+	})
+}
+
+func TestValid(t *testing.T) {
+	for _, s := range []string{"0.0", "-0.0", "1.2", "-12.3", "99.9", "05.5"} {
+		if !Valid([]byte(s)) {
+			t.Errorf("Valid(%q) = false", s)
+		}
+	}
+	for _, s := range []string{"", "-", "1", "1.", ".1", "12", "1.23", "123.4", "--1.2", "+1.2", "1,2", "a.b", "1.2\n"} {
+		if Valid([]byte(s)) {
+			t.Errorf("Valid(%q) = true", s)
+		}
+	}
+}
+
+func TestFixed(t *testing.T) {
+	tests := []struct {
+		in     string
+		digits int
+		v      int
+		n      int
+		ok     bool
+	}{
+		{"12\n", 0, 12, 2, true},
+		{"-7\n", 0, -7, 2, true},
+		{"1.2\n", 1, 12, 3, true},
+		{"-99.9\nAbha;1.0", 1, -999, 5, true},
+		{"142.7\n", 1, 1427, 5, true},
+		{"-273.15\n", 2, -27315, 7, true},
+		{"0.001\n", 3, 1, 5, true},
+		{"-0.000\n", 3, 0, 6, true},
+		{"1.2", 1, 12, 3, true},    // end of b
+		{"1.2;", 1, 0, 3, false},   // no '\n'
+		{"1.2\n", 2, 0, 3, false},  // too few digits
+		{"1.23\n", 1, 0, 3, false}, // too many digits
+		{"12\n", 1, 0, 2, false},   // no '.'
+		{"1.2\n", 0, 0, 1, false},  // unexpected '.'
+		{"-.5\n", 1, 0, 1, false},  // no integer digit
+		{"+1.5\n", 1, 0, 0, false}, // sign
+		{"1 .5\n", 1, 0, 1, false}, // space
+		{"1234567890123456.0\n", 1, 0, 16, false},
+	}
+
+	for _, tt := range tests {
+		v, n, ok := Fixed([]byte(tt.in), tt.digits)
+		if v != tt.v || n != tt.n || ok != tt.ok {
+			t.Errorf("Fixed(%q, %d) = %d, %d, %v; want %d, %d, %v", tt.in, tt.digits, v, n, ok, tt.v, tt.n, tt.ok)
+		}
+	}
+}
+
+func TestTempWide(t *testing.T) {
+	tests := []struct {
+		in   string
+		temp int
+		n    int
+		ok   bool
+	}{
+		{"1.2\n", 12, 3, true},
+		{"-12.3\nMünchen;1.0", -123, 5, true},
+		{"142.7\n", 1427, 5, true},
+		{"-273.1\n", -2731, 6, true},
+		{"1234.5\nAbha;1.0", 12345, 6, true},
+		{"-0.0\n", 0, 4, true},
+		{"-12.3", -123, 5, true},
+		{"142.7", 1427, 5, true},
+		{"1.25\n", 0, 3, false},
+		{"-.5\n", 0, 1, false},
+		{"142\n", 0, 3, false},
+	}
+
+	for _, tt := range tests {
+		temp, n, ok := TempWide([]byte(tt.in))
+		if temp != tt.temp || n != tt.n || ok != tt.ok {
+			t.Errorf("TempWide(%q) = %d, %d, %v; want %d, %d, %v", tt.in, temp, n, ok, tt.temp, tt.n, tt.ok)
+		}
+	}
+}
+
+// go test -run=XXX -fuzz=FuzzTempWide ./parse
+func FuzzTempWide(f *testing.F) {
+	for _, seed := range []string{"1.2", "-12.3", "142.7", "-273.1", "1234.5", "1.x", "-x1.5", "1..2"} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, s string) {
+		b := []byte(s + "\n;")
+		want, wantN, wantOk := Fixed(b, 1)
+		temp, n, ok := TempWide(b)
+		if ok != wantOk || ok && (temp != want || n != wantN) {
+			t.Errorf("TempWide(%q) = %d, %d, %v; want %d, %d, %v", s, temp, n, ok, want, wantN, wantOk)
+		}
+	})
+}
+
+func BenchmarkTemp(b *testing.B) {
+	num := []byte("-77.7\nMünchen;")
+
+	for i := 0; i < b.N; i++ {
+		_, _ = Temp(num)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"runtime/trace"
+)
+
+// ==================================================================================== //
+// Profiling
+// ==================================================================================== //
+// go run . -cpuprofile cpu.prof measurements_1b.txt
+// go tool pprof -http=:8080 cpu.prof
+
+type profileFlags struct {
+	cpu   string
+	mem   string
+	trace string
+	block string
+}
+
+func (p *profileFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&p.cpu, "cpuprofile", "", "write a cpu profile to `file`")
+	fs.StringVar(&p.mem, "memprofile", "", "write a memory profile to `file` after the run")
+	fs.StringVar(&p.trace, "trace", "", "write an execution trace to `file`")
+	fs.StringVar(&p.block, "blockprofile", "", "write a goroutine blocking profile to `file` after the run")
+}
+
+// start starts all requested profiles.
+// The returned func stops them and writes the ones that are taken at the end.
+func (p *profileFlags) start() (stop func()) {
+	var stops []func()
+
+	if p.cpu != "" {
+		f := create(p.cpu)
+		if err := pprof.StartCPUProfile(f); err != nil {
+			panic(err)
+		}
+		stops = append(stops, func() {
+			pprof.StopCPUProfile()
+			closeFile(f)
+		})
+	}
+
+	if p.trace != "" {
+		f := create(p.trace)
+		if err := trace.Start(f); err != nil {
+			panic(err)
+		}
+		stops = append(stops, func() {
+			trace.Stop()
+			closeFile(f)
+		})
+	}
+
+	if p.block != "" {
+		runtime.SetBlockProfileRate(1)
+		stops = append(stops, func() {
+			writeProfile("block", p.block)
+			runtime.SetBlockProfileRate(0)
+		})
+	}
+
+	if p.mem != "" {
+		stops = append(stops, func() {
+			runtime.GC() // up-to-date statistics
+			writeProfile("heap", p.mem)
+		})
+	}
+
+	return func() {
+		for _, stop := range stops {
+			stop()
+		}
+	}
+}
+
+func writeProfile(name, path string) {
+	f := create(path)
+	if err := pprof.Lookup(name).WriteTo(f, 0); err != nil {
+		panic(err)
+	}
+	closeFile(f)
+}
+
+func create(path string) *os.File {
+	f, err := os.Create(path)
+	if err != nil {
+		panic(err)
+	}
+	return f
+}
+
+func closeFile(f *os.File) {
+	if err := f.Close(); err != nil {
+		panic(err)
+	}
+}
@@ -1,6 +1,7 @@
 package run_6
 
 import (
+	"1brc/parse"
 	"bufio"
 	"fmt"
 	"io"
@@ -34,7 +35,7 @@ func Entrypoint(w io.Writer, filepath string) {
 		line := scanner.Bytes()
 
 		name, tempb := splitLine(line)
-		temp := lineToInt(tempb)
+		temp, _ := parse.Temp(tempb)
 
 		if c, ok := stations[name]; ok { // update stationData
 			c.Max = max(c.Max, temp)
@@ -72,28 +73,6 @@ func splitLine(line []byte) (string, []byte) {
 	}
 }
 
-// lineToInt converts the second part of a line to int.
-// "-77.7" => -777
-// "77.7" => 777
-func lineToInt(bs []byte) int {
-	neg := bs[0] == '-'
-	if neg {
-		bs = bs[1:]
-	}
-
-	var res int
-	if bs[1] == '.' {
-		res = int(bs[0]-48)*10 + int(bs[2]-48)
-	} else { // bs[2] == '.'
-		res = int(bs[0]-48)*100 + int(bs[1]-48)*10 + int(bs[3]-48)
-	}
-
-	if neg {
-		return -res
-	}
-	return res
-}
-
 func ceilPrecision1(val float64) float64 {
 	return math.Ceil(val*10) / 10
 }
@@ -1,6 +1,7 @@
 package run_8
 
 import (
+	"1brc/parse"
 	"bytes"
 	"io"
 	"os"
@@ -28,28 +29,6 @@ func newStationScanner(f *os.File) *StationScanner {
 	}
 }
 
-// intTemp converts the second part of a line to int.
-// "-77.7" => -777
-// "77.7" => 777
-func (s *StationScanner) intTemp(bs []byte) int {
-	neg := bs[0] == '-'
-	if neg {
-		bs = bs[1:]
-	}
-
-	var res int
-	if bs[1] == '.' {
-		res = int(bs[0]-48)*10 + int(bs[2]-48)
-	} else { // bs[2] == '.'
-		res = int(bs[0]-48)*100 + int(bs[1]-48)*10 + int(bs[3]-48)
-	}
-
-	if neg {
-		return -res
-	}
-	return res
-}
-
 func (s *StationScanner) updateChunk() {
 	if s.end-s.start >= maxLineLength && !s.eof {
 		return // still at least one whole line left in s.chunk
@@ -89,17 +68,8 @@ func (s *StationScanner) Line() (name string, temp int) {
 	bName := lines[:l]
 	name = unsafe.String(unsafe.SliceData(bName), len(bName))
 
-	switch {
-	case lines[l+4] == '\n': // 1.2
-		s.start += l + 5 // increment the start position by the bytes used
-		return name, s.intTemp(lines[l+1 : l+4])
-	case lines[l+5] == '\n': // 12.3 or -1.2
-		s.start += l + 6
-		return name, s.intTemp(lines[l+1 : l+5])
-	case lines[l+6] == '\n': // -12.3
-		s.start += l + 7
-		return name, s.intTemp(lines[l+1 : l+6])
-	default:
-		panic("not a line")
-	}
+	temp, n := parse.Temp(lines[l+1:])
+	s.start += l + n + 2 // increment the start position by the bytes used incl. ';' and '\n'
+
+	return name, temp
 }
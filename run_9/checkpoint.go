@@ -0,0 +1,130 @@
+package run_9
+
+import (
+	"1brc/stats"
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ==================================================================================== //
+// Checkpoint
+// ==================================================================================== //
+
+// checkpoint is the state of an interrupted run.
+// All lines before Offset are aggregated in Stations.
+type checkpoint struct {
+	Offset   int64
+	Stations stats.Table
+
+	// Input identifies the file the checkpoint was written for
+	Input input
+	// Options describes the options the Stations were aggregated with, see [Options.checkpointKey]
+	Options string
+}
+
+// input identifies a file at the time of a checkpoint.
+type input struct {
+	Path    string // absolute
+	Size    int64
+	ModTime time.Time
+	// Sample is a hash of the first and last checkpointSample bytes before the offset,
+	// to tell a file which was only appended to from one which was rewritten.
+	Sample [sha256.Size]byte
+}
+
+// checkpointSample is the length of the start and end of the processed part of a file hashed into [input.Sample]
+const checkpointSample = 64 << 10
+
+// identify returns the identity of file at path with the lines before offset processed.
+func identify(file *os.File, path string, offset int64) (input, error) {
+	var in input
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return in, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return in, err
+	}
+	in.Path, in.Size, in.ModTime = abs, info.Size(), info.ModTime()
+
+	h := sha256.New()
+	head := min(offset, checkpointSample)
+	tail := max(head, offset-checkpointSample) // the end of the sample doesn't overlap its start
+	if _, err := io.Copy(h, io.NewSectionReader(file, 0, head)); err != nil {
+		return in, err
+	}
+	if _, err := io.Copy(h, io.NewSectionReader(file, tail, offset-tail)); err != nil {
+		return in, err
+	}
+	h.Sum(in.Sample[:0])
+	return in, nil
+}
+
+// check returns an error if the file isn't the one cp was written for, or was changed other than by appending to it.
+// The options the stations were aggregated with have to be the same as well.
+func (cp checkpoint) check(file *os.File, path string, options string) error {
+	if cp.Options != options {
+		return fmt.Errorf("checkpoint was written with other options: %s", cp.Options)
+	}
+
+	in, err := identify(file, path, cp.Offset)
+	switch {
+	case err != nil:
+		return err
+	case cp.Input.Path != in.Path:
+		return fmt.Errorf("checkpoint was written for %s, not %s", cp.Input.Path, in.Path)
+	case cp.Offset > in.Size:
+		return fmt.Errorf("checkpoint at offset %d is beyond the end of %s", cp.Offset, path)
+	case !bytes.Equal(in.Sample[:], cp.Input.Sample[:]),
+		in.Size < cp.Input.Size,
+		in.Size == cp.Input.Size && !in.ModTime.Equal(cp.Input.ModTime): // rewritten in place
+		return fmt.Errorf("%s was changed since the checkpoint", path)
+	}
+	return nil // unchanged or appended to
+}
+
+// writeCheckpoint replaces the checkpoint at path atomically,
+// so a crash while writing leaves the previous one intact.
+func writeCheckpoint(path string, cp checkpoint) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	if err := gob.NewEncoder(f).Encode(cp); err != nil {
+		_ = f.Close()
+		return err
+	}
+	// the data has to be on disk before the rename is, otherwise a crash may leave an empty checkpoint
+	if err := f.Sync(); err != nil {
+		return errors.Join(err, f.Close())
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+func readCheckpoint(path string) (checkpoint, error) {
+	var cp checkpoint
+
+	f, err := os.Open(path)
+	if err != nil {
+		return cp, err
+	}
+	defer f.Close()
+
+	err = gob.NewDecoder(f).Decode(&cp)
+	return cp, err
+}
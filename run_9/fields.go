@@ -0,0 +1,90 @@
+package run_9
+
+import (
+	"1brc/parse"
+	"bytes"
+	"fmt"
+)
+
+// ==================================================================================== //
+// Fields
+// ==================================================================================== //
+
+// maxFieldsLength is what lines may be longer if they have more fields than station and temperature
+const maxFieldsLength = 512
+
+// fields locates station and temperature in lines with another separator than ';' or more fields.
+type fields struct {
+	sep           byte
+	station, temp int  // 1-based like cut -f
+	quoted        bool // fields may be quoted, see [unquote]
+}
+
+// split returns the fields of station and temperature in line without '\n'.
+// escaped reports if the quoted station contains escaped quotes.
+func (f *fields) split(line []byte) (station, temp []byte, escaped bool, ok bool) {
+	for i, n := 0, 1; ; n++ {
+		var field []byte
+		var fieldEscaped bool
+		j := -1 // position of the separator after the field in line[i:]
+		if f.quoted && i < len(line) && line[i] == '"' {
+			var l int
+			if field, fieldEscaped, l, ok = unquote(line[i:]); !ok {
+				return nil, nil, false, false
+			}
+			if i+l < len(line) {
+				if line[i+l] != f.sep {
+					return nil, nil, false, false
+				}
+				j = l
+			}
+		} else {
+			j = bytes.IndexByte(line[i:], f.sep)
+			field = line[i:]
+			if j != -1 {
+				field = line[i : i+j]
+			}
+		}
+
+		switch n {
+		case f.station:
+			station, escaped = field, fieldEscaped
+		case f.temp:
+			temp = field
+		}
+		if station != nil && temp != nil {
+			return station, temp, escaped, true
+		}
+		if j == -1 {
+			return nil, nil, false, false
+		}
+		i += j + 1
+	}
+}
+
+// lineFields replaces [StationScanner.Line] for lines described by s.fields.
+func (s *StationScanner) lineFields() (name string, temp int) {
+	lines := s.chunk[s.start:s.end]
+	end := indexByte(lines, '\n')
+
+	bName, bTemp, escaped, ok := s.fields.split(lines[:end])
+	if !ok {
+		panic(fmt.Sprintf("line %d: less than %d fields or invalid quotes", s.rows+1, max(s.fields.station, s.fields.temp)))
+	}
+	name = quotedName(bName, escaped)
+
+	var n int
+	if s.parseTemp == nil {
+		temp, n = parse.Temp(bTemp)
+		ok = n == len(bTemp)
+	} else {
+		temp, n, ok = s.parseTemp(bTemp)
+	}
+	if !ok {
+		panic(fmt.Sprintf("line %d: invalid temperature %q", s.rows+1, bTemp))
+	}
+
+	s.start += end + 1
+	s.rows++
+	return name, temp
+}
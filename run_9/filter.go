@@ -0,0 +1,121 @@
+package run_9
+
+import (
+	"strings"
+	"unicode"
+
+	"1brc/stats"
+)
+
+// ==================================================================================== //
+// Filter
+// ==================================================================================== //
+
+// filter decides about a station when it is first seen, whether it's aggregated and under which name.
+// Discarded stations are added to the stations pointing to discarded, so their following lines
+// are resolved by the same hash lookup as any other station and aggregated into the void.
+// Likewise names which aren't normalized are added as aliases pointing to the station of their normalized name.
+type filter struct {
+	*stats.Filter // may be nil if only normalizing
+	discarded     *stationData
+
+	normalize func(name string) string // may be nil
+	aliases   map[string]bool
+}
+
+// newFilter adds the names excluded by f to stations, so they don't even have to be checked once.
+// If names are normalized, f is matched against the normalized names, so its names and prefixes are normalized as well.
+func newFilter(f *stats.Filter, normalize func(string) string, stations map[string]*stationData) *filter {
+	if f != nil && normalize != nil {
+		f = &stats.Filter{Include: normalizeRules(f.Include, normalize), Exclude: normalizeRules(f.Exclude, normalize)}
+	}
+
+	ft := &filter{Filter: f, discarded: &stationData{}, normalize: normalize, aliases: map[string]bool{}}
+	if f == nil {
+		return ft
+	}
+	for name := range f.Exclude.Names {
+		if _, ok := stations[name]; !ok {
+			stations[name] = ft.discarded
+		}
+	}
+	return ft
+}
+
+// normalizeRules returns a copy of r with normalized names and prefixes, regexps have to match normalized names as they are.
+// Trailing white space is part of a prefix, "Ham " shouldn't match "Hamburg", so it's kept even if names are trimmed.
+func normalizeRules(r stats.Rules, normalize func(string) string) stats.Rules {
+	n := stats.Rules{Regexps: r.Regexps}
+	if r.Names != nil {
+		n.Names = make(map[string]bool, len(r.Names))
+		for name, ok := range r.Names {
+			n.Names[normalize(name)] = ok
+		}
+	}
+	for _, p := range r.Prefixes {
+		space := p[len(strings.TrimRightFunc(p, unicode.IsSpace)):]
+		if np := normalize(p); strings.HasSuffix(np, space) {
+			n.Prefixes = append(n.Prefixes, np)
+		} else {
+			n.Prefixes = append(n.Prefixes, np+space)
+		}
+	}
+	return n
+}
+
+// resolve returns the name the station name is aggregated under and if it's kept at all.
+func (f *filter) resolve(name string) (key string, keep bool) {
+	key = name
+	if f.normalize != nil {
+		key = f.normalize(name)
+	}
+	return key, f.Filter == nil || f.Keep(key)
+}
+
+// add adds the first line of the station name, which isn't in stations yet.
+func (f *filter) add(stations map[string]*stationData, name string, temp int) {
+	key, keep := f.resolve(name)
+
+	c, ok := stations[key]
+	switch {
+	case ok: // another name of the station
+		c.Max = max(c.Max, temp)
+		c.Min = min(c.Min, temp)
+		c.Sum += temp
+		c.Count++
+	case !keep:
+		c = f.discarded
+	default:
+		c = &stationData{Min: temp, Max: temp, Sum: temp, Count: 1}
+	}
+
+	stations[key] = c
+	if key != name {
+		stations[name] = c
+		f.aliases[name] = true
+	}
+}
+
+// remove deletes the discarded stations and aliases.
+func (f *filter) remove(stations map[string]*stationData) {
+	if f == nil {
+		return
+	}
+	for name, c := range stations {
+		if c == f.discarded || f.aliases[name] {
+			delete(stations, name)
+		}
+	}
+}
+
+// clone returns a deep copy of stations without the discarded ones and aliases.
+func (f *filter) clone(stations map[string]*stationData) stats.Table {
+	c := make(stats.Table, len(stations))
+	for name, s := range stations {
+		if f == nil || s != f.discarded && !f.aliases[name] {
+			cs := *s
+			c[name] = &cs
+		}
+	}
+	return c
+}
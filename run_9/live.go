@@ -0,0 +1,115 @@
+package run_9
+
+import (
+	"1brc/parse"
+	"1brc/stats"
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ==================================================================================== //
+// Live
+// ==================================================================================== //
+
+// ErrTooManyStations is returned by [Live.Add] if a batch would exceed [Live.MaxStations].
+var ErrTooManyStations = errors.New("too many stations")
+
+// Live aggregates batches of measurements as they arrive instead of a whole file.
+// It is safe for concurrent use.
+type Live struct {
+	// MaxStations limits the number of distinct stations, 0 means no limit.
+	MaxStations int
+
+	mu       sync.Mutex
+	stations stats.Table
+}
+
+func NewLive() *Live {
+	return &Live{stations: stats.NewTable()}
+}
+
+// Add aggregates the lines "name;temp\n" in batch and returns their number.
+// The batch is either added as a whole or, if a line is malformed, not at all.
+func (l *Live) Add(batch []byte) (rows int, err error) {
+	if err := validate(batch); err != nil {
+		return 0, err
+	}
+
+	// the batch is aggregated on its own without holding the lock and merged afterwards,
+	// it's in memory and validated already, so it's scanned in place
+	scanner := newBytesScanner(batch)
+	stations := make(map[string]*stationData, 100)
+	aggregateInto(scanner, stations, nil)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.MaxStations > 0 {
+		n := len(l.stations)
+		for name := range stations {
+			if _, ok := l.stations[name]; !ok {
+				n++
+			}
+		}
+		if n > l.MaxStations {
+			return 0, ErrTooManyStations
+		}
+	}
+
+	l.stations.Merge(stations)
+	return int(scanner.rows), nil
+}
+
+// Station returns the measurements of a single station.
+func (l *Live) Station(name string) (stats.Station, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	c, ok := l.stations[name]
+	if !ok {
+		return stats.Station{}, false
+	}
+	return *c, true
+}
+
+// Table returns a copy of all stations.
+func (l *Live) Table() stats.Table {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.stations.Clone()
+}
+
+// validate checks that every line of batch can be handled by [StationScanner.Line].
+func validate(batch []byte) error {
+	for i := 1; len(batch) > 0; i++ {
+		line := batch
+		if n := bytes.IndexByte(batch, '\n'); n != -1 {
+			line, batch = batch[:n], batch[n+1:]
+		} else {
+			batch = nil
+		}
+
+		if err := ValidateLine(line); err != nil {
+			return fmt.Errorf("line %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// ValidateLine checks that a single line "name;temp" without '\n' can be handled by [StationScanner.Line],
+// for input which isn't trusted like the challenge's.
+func ValidateLine(line []byte) error {
+	l := bytes.IndexByte(line, ';')
+	switch {
+	case l == -1:
+		return errors.New("missing ';'")
+	case l == 0 || l > 100:
+		return errors.New("station name must be 1 to 100 bytes")
+	case !parse.Valid(line[l+1:]):
+		return fmt.Errorf("invalid temperature %q", line[l+1:])
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package run_9
+
+import (
+	"fmt"
+	"time"
+)
+
+// ==================================================================================== //
+// Progress
+// ==================================================================================== //
+
+// Progress is a snapshot of how far a [StationScanner] got.
+type Progress struct {
+	Bytes   int64 // consumed so far
+	Size    int64 // of the whole file
+	Start   int64 // offset reading started at, > 0 when resumed from a checkpoint
+	Rows    int64 // since Start
+	Elapsed time.Duration
+	Done    bool
+}
+
+// BytesPerSec is 0 right at the start, instead of +Inf or NaN.
+func (p Progress) BytesPerSec() float64 {
+	if p.Elapsed <= 0 {
+		return 0
+	}
+	return float64(p.Bytes-p.Start) / p.Elapsed.Seconds()
+}
+
+// RowsPerSec is 0 right at the start, instead of +Inf or NaN.
+func (p Progress) RowsPerSec() float64 {
+	if p.Elapsed <= 0 {
+		return 0
+	}
+	return float64(p.Rows) / p.Elapsed.Seconds()
+}
+
+// ETA estimates the remaining time from the throughput so far.
+func (p Progress) ETA() time.Duration {
+	if p.Bytes == p.Start || p.Bytes >= p.Size || p.Elapsed <= 0 {
+		return 0
+	}
+	return time.Duration(float64(p.Size-p.Bytes) / p.BytesPerSec() * float64(time.Second))
+}
+
+// "1.2GB / 13.8GB (8.7%), 90.1M rows, 3.1M rows/s, 128.4MB/s, ETA 1m38s"
+func (p Progress) String() string {
+	percent := 100.0
+	if p.Size > 0 {
+		percent = float64(p.Bytes) / float64(p.Size) * 100
+	}
+
+	return fmt.Sprintf("%s / %s (%.1f%%), %s rows, %s rows/s, %s/s, ETA %s",
+		humanBytes(float64(p.Bytes)),
+		humanBytes(float64(p.Size)),
+		percent,
+		humanCount(float64(p.Rows)),
+		humanCount(p.RowsPerSec()),
+		humanBytes(p.BytesPerSec()),
+		p.ETA().Round(time.Second),
+	)
+}
+
+func humanBytes(b float64) string {
+	switch {
+	case b >= float64(GB):
+		return fmt.Sprintf("%.1fGB", b/float64(GB))
+	case b >= float64(MB):
+		return fmt.Sprintf("%.1fMB", b/float64(MB))
+	case b >= float64(KB):
+		return fmt.Sprintf("%.1fKB", b/float64(KB))
+	default:
+		return fmt.Sprintf("%.0fB", b)
+	}
+}
+
+func humanCount(n float64) string {
+	switch {
+	case n >= 1e9:
+		return fmt.Sprintf("%.1fB", n/1e9)
+	case n >= 1e6:
+		return fmt.Sprintf("%.1fM", n/1e6)
+	case n >= 1e3:
+		return fmt.Sprintf("%.1fK", n/1e3)
+	default:
+		return fmt.Sprintf("%.0f", n)
+	}
+}
+
+// progressReporter calls fn at most every interval.
+// It is only called on refills of the [StationScanner], the hot loop only counts the rows.
+type progressReporter struct {
+	fn       func(Progress)
+	interval time.Duration
+	size     int64
+	start    int64
+
+	started time.Time
+	last    time.Time
+}
+
+func newProgressReporter(fn func(Progress), interval time.Duration, size int64) *progressReporter {
+	now := time.Now()
+	return &progressReporter{
+		fn:       fn,
+		interval: interval,
+		size:     size,
+		started:  now,
+		last:     now,
+	}
+}
+
+func (r *progressReporter) update(bytes, rows int64, done bool) {
+	now := time.Now()
+	if !done && now.Sub(r.last) < r.interval {
+		return
+	}
+	r.last = now
+
+	r.fn(Progress{
+		Bytes:   bytes,
+		Size:    max(r.size, bytes), // the file may grow when following it
+		Start:   r.start,
+		Rows:    rows,
+		Elapsed: now.Sub(r.started),
+		Done:    done,
+	})
+}
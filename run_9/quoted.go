@@ -0,0 +1,65 @@
+package run_9
+
+import (
+	"1brc/parse"
+	"fmt"
+	"strings"
+	"unsafe"
+)
+
+// ==================================================================================== //
+// Quoted Names
+// ==================================================================================== //
+
+// maxQuotesLength is how much longer a line may get by quoting a name of 100 bytes, all quotes escaped
+const maxQuotesLength = 102
+
+// unquote reads the field quoted as in RFC 4180 at the start of b, quotes inside are escaped by doubling them.
+// n is the length of the field incl. the quotes, ok is false if there is no closing quote before '\n' or the end of b.
+func unquote(b []byte) (field []byte, escaped bool, n int, ok bool) {
+	for i := 1; i < len(b); i++ {
+		switch b[i] {
+		case '\n':
+			return nil, false, 0, false
+		case '"':
+			if i+1 < len(b) && b[i+1] == '"' {
+				escaped = true
+				i++
+				continue
+			}
+			return b[1:i], escaped, i + 1, true
+		}
+	}
+	return nil, false, 0, false
+}
+
+// quotedName turns a field returned by unquote into a name.
+// Only names with escaped quotes are copied, which happens for every line of such a station.
+func quotedName(field []byte, escaped bool) string {
+	if escaped {
+		return strings.ReplaceAll(string(field), `""`, `"`)
+	}
+	return unsafe.String(unsafe.SliceData(field), len(field))
+}
+
+// lineQuoted replaces [StationScanner.Line] for lines starting with '"'.
+func (s *StationScanner) lineQuoted() (name string, temp int) {
+	lines := s.chunk[s.start:s.end]
+
+	field, escaped, l, ok := unquote(lines)
+	if !ok || l == len(lines) || lines[l] != ';' {
+		panic(fmt.Sprintf("line %d: invalid quoted station name", s.rows+1))
+	}
+	name = quotedName(field, escaped)
+
+	var n int
+	if s.parseTemp == nil {
+		temp, n = parse.Temp(lines[l+1:])
+	} else if temp, n, ok = s.parseTemp(lines[l+1:]); !ok {
+		panic(fmt.Sprintf("line %d: invalid temperature %q", s.rows+1, lines[l+1:l+1+n]))
+	}
+
+	s.start += l + n + 2
+	s.rows++
+	return name, temp
+}
@@ -1,17 +1,23 @@
 package run_9
 
 import (
+	"1brc/stats"
+	"cmp"
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"math"
 	"os"
-	"slices"
+	"time"
 )
 
 const (
 	B  int = 1
 	KB     = B << 10
 	MB     = KB << 10
+	GB     = MB << 10
 )
 
 // maxLineLength does not need to be exact just > the longest possible line
@@ -23,24 +29,254 @@ const chunkSize = 16 * MB
 // Run
 // ==================================================================================== //
 
-type stationData struct {
-	Min   int
-	Max   int
-	Sum   int
-	Count uint
-}
+type stationData = stats.Station
 
 func Entrypoint(w io.Writer, filepath string) {
-	file, err := os.Open(filepath)
+	stations, err := Aggregate(context.Background(), filepath, Options{})
 	if err != nil {
 		panic(err)
 	}
+
+	printCities(w, stations)
+}
+
+// Options configure [Aggregate], the zero value equals [Entrypoint].
+type Options struct {
+	// Progress is called at most every ProgressInterval while reading and once at the end.
+	Progress         func(Progress)
+	ProgressInterval time.Duration
+
+	// Follow keeps reading the file as it grows, like `tail -f`, polling every PollInterval at EOF.
+	// Aggregate then only returns once ctx is cancelled.
+	Follow       bool
+	PollInterval time.Duration
+	// Snapshot is called with a copy of the stations at most every SnapshotInterval while following.
+	Snapshot         func(stats.Table)
+	SnapshotInterval time.Duration
+
+	// Checkpoint is a file the offset of the last processed line and the stations are written to
+	// at most every CheckpointInterval and when stopped early. It is removed after a complete run.
+	Checkpoint         string
+	CheckpointInterval time.Duration
+	// Resume continues from Checkpoint if it exists. It's an error if the file was changed other than by appending to it,
+	// or the options the stations are aggregated with differ.
+	Resume bool
+	// CheckpointKey describes what [Options.ParseTemp] and [Options.Normalize] do, e.g. the digits parsed,
+	// as funcs can't be compared. A checkpoint is only resumed with the same key.
+	CheckpointKey string
+
+	// Filter selects the stations which are aggregated, nil keeps all.
+	Filter *stats.Filter
+
+	// Normalize merges station names, e.g. [stats.Normalization.Apply], filters see the normalized names.
+	// It's only called once for every new name, which from then on is an alias of the normalized one.
+	Normalize func(name string) string
+
+	// ParseTemp replaces the fast [parse.Temp] for temperatures in another format, e.g. with more digits.
+	// It gets the rest of the line incl. '\n' and returns the length of the temperature or ok = false
+	// if it's malformed, which makes the scanner panic.
+	ParseTemp func(b []byte) (temp int, n int, ok bool)
+	// WideRange allows temperatures with any number of integer digits, e.g. 142.7 or -273.1.
+	// Either the fast parser with a fallback or a general one is picked by the start of the file.
+	WideRange bool
+
+	// Separator of the fields, ';' if 0.
+	Separator byte
+	// StationField and TempField are the positions of station and temperature starting at 1, 1 and 2 if 0.
+	// Lines may have other fields as well, e.g. "id,station,country,temp" with StationField 2 and TempField 4.
+	StationField, TempField int
+	// Quoted allows station names quoted as in CSV, e.g. "Washington; DC" or "The ""Best"" Place".
+	// Only lines starting with '"' take the slower path, unless the fields are configured as well.
+	Quoted bool
+}
+
+// checkpointKey describes the options which change the aggregated stations,
+// a checkpoint written with other ones can't be resumed.
+func (opts Options) checkpointKey() string {
+	filter := ""
+	if opts.Filter != nil {
+		filter = opts.Filter.String()
+	}
+	return fmt.Sprintf("key=%q parse=%t normalize=%t wide=%t sep=%q fields=%d,%d quoted=%t filter=%q",
+		opts.CheckpointKey, opts.ParseTemp != nil, opts.Normalize != nil, opts.WideRange,
+		opts.Separator, opts.StationField, opts.TempField, opts.Quoted, filter)
+}
+
+// maxTempLength is the longest temperature [Options.ParseTemp] may return to fit into a line
+const maxTempLength = 24
+
+const defaultPollInterval = 100 * time.Millisecond
+
+// fields returns nil for lines as in the challenge.
+func (opts Options) fields() (*fields, error) {
+	if opts.Separator == 0 && opts.StationField == 0 && opts.TempField == 0 {
+		return nil, nil
+	}
+
+	f := &fields{
+		sep:     cmp.Or(opts.Separator, ';'),
+		station: cmp.Or(opts.StationField, 1),
+		temp:    cmp.Or(opts.TempField, 2),
+		quoted:  opts.Quoted,
+	}
+	if f.station < 1 || f.temp < 1 || f.station == f.temp {
+		return nil, fmt.Errorf("station field %d and temperature field %d must be different and at least 1", f.station, f.temp)
+	}
+	if f.sep == '\n' || f.sep == '"' || f.sep == '-' || f.sep == '.' || f.sep >= '0' && f.sep <= '9' {
+		return nil, fmt.Errorf("separator %q is part of a line or temperature", f.sep)
+	}
+	return f, nil
+}
+
+// Aggregate reads the measurements at filepath.
+// Cancelling ctx stops reading at the next refill of the buffer,
+// the stations aggregated so far are returned along with ctx.Err().
+func Aggregate(ctx context.Context, filepath string, opts Options) (stats.Table, error) {
+	file, err := os.Open(filepath)
+	if err != nil {
+		return nil, err
+	}
 	defer file.Close()
 
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
 	stations := make(map[string]*stationData, maxStationCount)
 
-	scanner := newStationScanner(file)
+	var offset int64
+	if opts.Resume && opts.Checkpoint != "" {
+		cp, err := readCheckpoint(opts.Checkpoint)
+		switch {
+		case errors.Is(err, fs.ErrNotExist): // nothing to resume
+		case err != nil:
+			return nil, fmt.Errorf("reading checkpoint: %w", err)
+		default:
+			if err := cp.check(file, filepath, opts.checkpointKey()); err != nil {
+				return nil, fmt.Errorf("can't resume: %w", err)
+			}
+			offset = cp.Offset
+			stations = cp.Stations
+		}
+	}
+
+	var filter *filter
+	if opts.Filter != nil || opts.Normalize != nil {
+		filter = newFilter(opts.Filter, opts.Normalize, stations)
+	}
+
+	var r io.Reader = file
+	if offset > 0 {
+		r = io.NewSectionReader(file, offset, math.MaxInt64-offset)
+	}
 
+	fields, err := opts.fields()
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.WideRange && opts.ParseTemp == nil {
+		opts.ParseTemp = wideParser(file, offset, fields)
+	}
+
+	maxLine := maxLineLength
+	if opts.ParseTemp != nil {
+		maxLine += maxTempLength
+	}
+	if fields != nil {
+		maxLine += maxFieldsLength
+	}
+	if opts.Quoted {
+		maxLine += maxQuotesLength
+	}
+	scanner := newStationScanner(r, chunkSize, maxLine)
+	scanner.ctx = ctx
+	scanner.read = offset
+	scanner.parseTemp = opts.ParseTemp
+	scanner.fields = fields
+	scanner.quoted = opts.Quoted
+
+	if opts.Progress != nil {
+		scanner.progress = newProgressReporter(opts.Progress, opts.ProgressInterval, info.Size())
+		scanner.progress.start = offset
+	}
+
+	var ticks []func() error
+
+	if opts.Follow {
+		scanner.follow = cmp.Or(opts.PollInterval, defaultPollInterval)
+		if opts.Snapshot != nil {
+			last := time.Now()
+			ticks = append(ticks, func() error {
+				if time.Since(last) >= opts.SnapshotInterval {
+					last = time.Now()
+					opts.Snapshot(filter.clone(stations))
+				}
+				return nil
+			})
+		}
+	}
+
+	// save writes a checkpoint with the stations aggregated until now
+	save := func(stations stats.Table) error {
+		offset := scanner.consumed()
+		in, err := identify(file, filepath, offset)
+		if err != nil {
+			return err
+		}
+		return writeCheckpoint(opts.Checkpoint, checkpoint{Offset: offset, Stations: stations, Input: in, Options: opts.checkpointKey()})
+	}
+
+	if opts.Checkpoint != "" {
+		last := time.Now()
+		ticks = append(ticks, func() error {
+			if time.Since(last) < opts.CheckpointInterval {
+				return nil
+			}
+			last = time.Now()
+			return save(filter.clone(stations))
+		})
+	}
+
+	if len(ticks) > 0 {
+		scanner.tick = func() error {
+			for _, tick := range ticks {
+				if err := tick(); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+
+	aggregateInto(scanner, stations, filter)
+	filter.remove(stations)
+
+	if opts.Checkpoint != "" {
+		if scanner.err != nil {
+			if err := save(stations); err != nil {
+				return stations, errors.Join(scanner.err, err)
+			}
+			return stations, scanner.err
+		}
+		if err := os.Remove(opts.Checkpoint); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return stations, err
+		}
+	}
+
+	return stations, scanner.err
+}
+
+func aggregate(scanner *StationScanner) map[string]*stationData {
+	stations := make(map[string]*stationData, maxStationCount)
+	aggregateInto(scanner, stations, nil)
+	return stations
+}
+
+// aggregateInto adds the lines of scanner to stations.
+// filter is only asked about stations which aren't in stations yet and may be nil.
+func aggregateInto(scanner *StationScanner, stations map[string]*stationData, filter *filter) {
 	for scanner.Next() {
 		name, temp := scanner.Line()
 
@@ -49,6 +285,8 @@ func Entrypoint(w io.Writer, filepath string) {
 			c.Min = min(c.Min, temp)
 			c.Sum += temp
 			c.Count++
+		} else if filter != nil { // filter or normalize the station once
+			filter.add(stations, name, temp)
 		} else { // add stationData
 			stations[name] = &stationData{
 				Min:   temp,
@@ -58,33 +296,9 @@ func Entrypoint(w io.Writer, filepath string) {
 			}
 		}
 	}
-
-	printCities(w, stations)
-}
-
-func ceilPrecision1(val float64) float64 {
-	return math.Ceil(val*10) / 10
 }
 
+// printCities writes the stations with the buffered writer of [stats.PrintCities] instead of a fmt call per station.
 func printCities(w io.Writer, cities map[string]*stationData) {
-	keys := make([]string, 0, len(cities))
-	for k, _ := range cities {
-		keys = append(keys, k)
-	}
-	slices.Sort(keys)
-
-	_, _ = fmt.Fprint(w, "{")
-	for i, key := range keys {
-		c := cities[key]
-		_, _ = fmt.Fprintf(w, "%s=%.1f/%.1f/%.1f",
-			key,
-			ceilPrecision1(float64(c.Min)/10),
-			ceilPrecision1(float64(c.Sum)/10/float64(c.Count)),
-			ceilPrecision1(float64(c.Max)/10),
-		)
-		if i+1 < len(keys) {
-			_, _ = fmt.Fprint(w, ", ")
-		}
-	}
-	_, _ = fmt.Fprint(w, "}\n")
+	stats.PrintCities(w, cities)
 }
@@ -1,8 +1,22 @@
 package run_9
 
 import (
+	"1brc/difftest"
+	"1brc/parse"
+	"1brc/stats"
 	"bytes"
+	"context"
+	"fmt"
+	"maps"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 var longSlice = []byte("igButeboJuršinciKoaniImdinaNova VasDestrnikVarvarinSkopunGornji PetrovciRibnicaKon TumŠavnikPodl;11.5")
@@ -20,3 +34,839 @@ func BenchmarkCustomIndex(b *testing.B) {
 		_ = indexByte(testSlice, ';')
 	}
 }
+
+// ==================================================================================== //
+// Small Chunks
+// ==================================================================================== //
+
+// Test_SmallChunks runs every sample with buffers from barely fitting the longest line up to holding the whole file.
+// That way every line is split by a refill in [StationScanner.updateChunk] at every possible position.
+func Test_SmallChunks(t *testing.T) {
+	matches, _ := filepath.Glob("../samples/*.txt")
+	if len(matches) == 0 {
+		t.Skip("no samples")
+	}
+
+	for _, match := range matches {
+		measurements, _ := os.ReadFile(match)
+		expected, _ := os.ReadFile(strings.TrimSuffix(match, ".txt") + ".out")
+
+		longest := 0 // incl. '\n'
+		for _, line := range bytes.SplitAfter(measurements, []byte("\n")) {
+			longest = max(longest, len(line))
+		}
+
+		for _, maxLine := range []int{longest, maxLineLength} {
+			for size := maxLine + 1; size <= len(measurements)+maxLine+1; size++ {
+				f, err := os.Open(match)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				var buf bytes.Buffer
+				printCities(&buf, aggregate(newStationScanner(f, size, maxLine)))
+				_ = f.Close()
+
+				if !bytes.Equal(buf.Bytes(), expected) {
+					t.Errorf("%s with chunk size %d and max line length %d:\n got %q\nwant %q",
+						match, size, maxLine, buf.Bytes(), expected)
+				}
+			}
+		}
+	}
+}
+
+// ==================================================================================== //
+// Progress
+// ==================================================================================== //
+
+func Test_Progress(t *testing.T) {
+	const sample = "../samples/measurements-20.txt"
+
+	f, err := os.Open(sample)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	info, _ := f.Stat()
+
+	var reports []Progress
+	sc := newStationScanner(f, 128, maxLineLength)
+	sc.progress = newProgressReporter(func(p Progress) { reports = append(reports, p) }, 0, info.Size())
+	aggregate(sc)
+
+	if len(reports) < 3 {
+		t.Fatalf("expected a report per refill, got %v", reports)
+	}
+	for i := 1; i < len(reports); i++ {
+		if reports[i].Bytes < reports[i-1].Bytes || reports[i].Rows < reports[i-1].Rows {
+			t.Errorf("progress went backwards: %v -> %v", reports[i-1], reports[i])
+		}
+	}
+
+	last := reports[len(reports)-1]
+	if !last.Done || last.Bytes != info.Size() || last.Rows != 20 || last.ETA() != 0 {
+		t.Errorf("unexpected final report %+v", last)
+	}
+
+	// a report right at the start has no rates yet
+	first := Progress{Bytes: 128, Size: info.Size(), Rows: 5}
+	if got := first.String(); strings.Contains(got, "Inf") || strings.Contains(got, "NaN") || first.BytesPerSec() != 0 || first.RowsPerSec() != 0 {
+		t.Errorf("report without elapsed time: %s", got)
+	}
+}
+
+// ==================================================================================== //
+// Cancellation
+// ==================================================================================== //
+
+func Test_Cancel(t *testing.T) {
+	f, err := os.Open("../samples/measurements-20.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sc := newStationScanner(f, 128, maxLineLength)
+	sc.ctx = ctx
+	sc.progress = newProgressReporter(func(p Progress) {
+		if p.Rows > 0 {
+			cancel()
+		}
+	}, 0, 0)
+	stations := aggregate(sc)
+
+	if sc.err != context.Canceled {
+		t.Fatalf("got error %v, want %v", sc.err, context.Canceled)
+	}
+
+	var rows uint
+	for _, s := range stations {
+		rows += s.Count
+	}
+	if rows == 0 || rows >= 20 || int64(rows) != sc.rows {
+		t.Fatalf("expected a partial result, got %d rows and %d scanned", rows, sc.rows)
+	}
+}
+
+// ==================================================================================== //
+// Follow
+// ==================================================================================== //
+
+func Test_Follow(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "measurements.txt")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	snapshots := make(chan stats.Table, 100)
+	done := make(chan stats.Table)
+	var progress []Progress // read after done
+	go func() {
+		stations, _ := Aggregate(ctx, path, Options{
+			Follow:       true,
+			PollInterval: time.Millisecond,
+			Snapshot:     func(t stats.Table) { snapshots <- t },
+			Progress:     func(p Progress) { progress = append(progress, p) },
+		})
+		done <- stations
+	}()
+
+	// waitFor waits for a snapshot with count rows
+	waitFor := func(count uint) {
+		t.Helper()
+		timeout := time.After(5 * time.Second)
+		for {
+			select {
+			case s := <-snapshots:
+				var rows uint
+				for _, st := range s {
+					rows += st.Count
+				}
+				if rows == count {
+					return
+				}
+			case <-timeout:
+				t.Fatalf("no snapshot with %d rows", count)
+			}
+		}
+	}
+
+	_, _ = f.WriteString("Hamburg;12.0\nBulawayo;8.9\n")
+	waitFor(2)
+
+	_, _ = f.WriteString("Hamburg;3") // incomplete line, not counted yet
+	_, _ = f.WriteString("4.2\nBulawayo;-1.0\n")
+	waitFor(4)
+
+	cancel()
+	stations := <-done
+
+	var buf bytes.Buffer
+	printCities(&buf, stations)
+	if want := "{Bulawayo=-1.0/4.0/8.9, Hamburg=12.0/23.1/34.2}\n"; buf.String() != want {
+		t.Fatalf("got %q, want %q", buf.String(), want)
+	}
+
+	// progress is reported while following as well
+	if len(progress) == 0 || progress[len(progress)-1].Rows != 4 {
+		t.Errorf("got progress %+v, want the last one with 4 rows", progress)
+	}
+}
+
+// ==================================================================================== //
+// Checkpoint
+// ==================================================================================== //
+
+// Test_Resume resumes from checkpoints at every line of a sample.
+func Test_Resume(t *testing.T) {
+	const sample = "../samples/measurements-20.txt"
+	measurements, _ := os.ReadFile(sample)
+	expected, _ := os.ReadFile("../samples/measurements-20.out")
+	path := filepath.Join(t.TempDir(), "checkpoint")
+
+	file, err := os.Open(sample)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	for offset := 0; offset < len(measurements); offset++ {
+		if offset > 0 && measurements[offset-1] != '\n' {
+			continue
+		}
+
+		partial := aggregate(newStationScanner(bytes.NewReader(measurements[:offset]), 128, maxLineLength))
+		in, err := identify(file, sample, int64(offset))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := writeCheckpoint(path, checkpoint{Offset: int64(offset), Stations: partial, Input: in, Options: Options{}.checkpointKey()}); err != nil {
+			t.Fatal(err)
+		}
+
+		stations, err := Aggregate(context.Background(), sample, Options{Checkpoint: path, Resume: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var buf bytes.Buffer
+		printCities(&buf, stations)
+		if !bytes.Equal(buf.Bytes(), expected) {
+			t.Errorf("resumed at %d:\n got %q\nwant %q", offset, buf.Bytes(), expected)
+		}
+
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Fatalf("checkpoint not removed after a complete run: %v", err)
+		}
+	}
+}
+
+// Test_ResumeChanged checks that a checkpoint is only resumed for the same file and options,
+// or the file with lines appended.
+func Test_ResumeChanged(t *testing.T) {
+	dir := t.TempDir()
+	input, path := filepath.Join(dir, "measurements.txt"), filepath.Join(dir, "checkpoint")
+	const measurements = "Hamburg;12.0\nBulawayo;8.9\nPalembang;38.8\n"
+	offset := int64(strings.Index(measurements, "Palembang"))
+
+	write := func(name, content string) {
+		t.Helper()
+		if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		change func()
+		opts   Options
+		want   string // in the error, none if empty
+	}{
+		{"unchanged", func() {}, Options{}, ""},
+		{"appended", func() { write(input, measurements+"Hamburg;1.0\n") }, Options{}, ""},
+		{"rewritten", func() { write(input, strings.Replace(measurements, "12.0", "99.0", 1)) }, Options{}, "was changed"},
+		{"rewritten and longer", func() { write(input, "Hamburg;99.0\n"+measurements) }, Options{}, "was changed"},
+		{"modified in place", func() {
+			if err := os.Chtimes(input, time.Time{}, time.Now().Add(time.Hour)); err != nil {
+				t.Fatal(err)
+			}
+		}, Options{}, "was changed"},
+		{"truncated", func() { write(input, "Hamburg;12.0\n") }, Options{}, "beyond the end"},
+		{"other digits", func() {}, Options{CheckpointKey: "digits=2"}, "other options"},
+		{"other filter", func() {}, Options{Filter: &stats.Filter{Include: stats.Rules{Prefixes: []string{"Ham"}}}}, "other options"},
+	}
+	for _, tt := range tests {
+		write(input, measurements)
+		file, err := os.Open(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		in, err := identify(file, input, offset)
+		file.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		partial := aggregate(newStationScanner(strings.NewReader(measurements[:offset]), 128, maxLineLength))
+		if err := writeCheckpoint(path, checkpoint{Offset: offset, Stations: partial, Input: in, Options: Options{}.checkpointKey()}); err != nil {
+			t.Fatal(err)
+		}
+
+		tt.change()
+		tt.opts.Checkpoint, tt.opts.Resume = path, true
+		stations, err := Aggregate(context.Background(), input, tt.opts)
+		switch {
+		case tt.want == "" && err != nil, tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)):
+			t.Errorf("%s: got error %v, want %q", tt.name, err, tt.want)
+		case tt.want == "" && (stations["Hamburg"] == nil || stations["Palembang"] == nil):
+			t.Errorf("%s: got %v", tt.name, stations)
+		}
+	}
+
+	// the checkpoint of another file with the same content
+	other := filepath.Join(dir, "other.txt")
+	write(other, measurements)
+	file, err := os.Open(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	in, err := identify(file, other, offset)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writeCheckpoint(path, checkpoint{Offset: offset, Stations: stats.Table{}, Input: in, Options: Options{}.checkpointKey()}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Aggregate(context.Background(), input, Options{Checkpoint: path, Resume: true}); err == nil || !strings.Contains(err.Error(), "was written for") {
+		t.Errorf("other file: got error %v", err)
+	}
+}
+
+func Test_CheckpointOnCancel(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := Aggregate(ctx, "../samples/measurements-20.txt", Options{Checkpoint: path, CheckpointInterval: time.Hour})
+	if err != context.Canceled {
+		t.Fatalf("got error %v, want %v", err, context.Canceled)
+	}
+
+	cp, err := readCheckpoint(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cp.Offset != 0 || len(cp.Stations) != 0 {
+		t.Fatalf("nothing should have been processed, got %+v", cp)
+	}
+}
+
+// ==================================================================================== //
+// Live
+// ==================================================================================== //
+
+func Test_Live(t *testing.T) {
+	measurements, _ := os.ReadFile("../samples/measurements-20.txt")
+	expected, _ := os.ReadFile("../samples/measurements-20.out")
+	lines := bytes.SplitAfter(measurements, []byte("\n"))
+
+	// every writer adds every n-th line, one at a time
+	const writers = 8
+	live := NewLive()
+	var wg sync.WaitGroup
+	for i := range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := i; j < len(lines); j += writers {
+				if _, err := live.Add(lines[j]); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	var buf bytes.Buffer
+	printCities(&buf, live.Table())
+	if buf.String() != string(expected) {
+		t.Errorf("expected %q, got %q", expected, buf.String())
+	}
+}
+
+// Test_LiveInPlace checks that a batch isn't copied into chunks, as the batches of serve may be large.
+func Test_LiveInPlace(t *testing.T) {
+	batch := bytes.Repeat([]byte("Hamburg;12.0\nBulawayo;-8.9\n"), 1<<18) // 7MB
+	batch = batch[:len(batch)-1]                                          // without the final '\n'
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	live := NewLive()
+	rows, err := live.Add(batch)
+	runtime.ReadMemStats(&after)
+	if err != nil || rows != 1<<19 {
+		t.Fatalf("got %d rows, %v", rows, err)
+	}
+	// the copy for the missing '\n' but not another one for the chunks
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 3*uint64(len(batch))/2 {
+		t.Errorf("allocated %d bytes for a batch of %d", allocated, len(batch))
+	}
+
+	var buf bytes.Buffer
+	printCities(&buf, live.Table())
+	if want := "{Bulawayo=-8.9/-8.9/-8.9, Hamburg=12.0/12.0/12.0}\n"; buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+}
+
+func Test_LiveRejects(t *testing.T) {
+	live := NewLive()
+	live.MaxStations = 1
+
+	for _, batch := range []string{"a;1.0\nb", "a;1.0\n;1.0\n", "a;1.0\na;1.00\n", "a;1.0\n\n", "a;1.0\nb;1.0\n"} {
+		if rows, err := live.Add([]byte(batch)); err == nil {
+			t.Errorf("Add(%q) = %d, nil", batch, rows)
+		}
+	}
+	if len(live.Table()) != 0 {
+		t.Errorf("rejected batches were added: %v", live.Table())
+	}
+
+	if rows, err := live.Add([]byte("a;1.0\na;-1.0")); rows != 2 || err != nil {
+		t.Errorf("Add = %d, %v", rows, err)
+	}
+	if s, ok := live.Station("a"); !ok || s != (stats.Station{Min: -10, Max: 10, Sum: 0, Count: 2}) {
+		t.Errorf("Station = %v, %v", s, ok)
+	}
+}
+
+// ==================================================================================== //
+// Time Windows
+// ==================================================================================== //
+
+func Test_Windows(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "measurements.txt")
+	measurements := "" +
+		"1704067200;Hamburg;12.0\n" + // 2024-01-01T00:00:00Z
+		"2024-01-01T00:59:59Z;Hamburg;-3.4\n" +
+		"2024-01-01T02:30:00+01:00;Hamburg;1.0\n" + // 01:30 UTC
+		"1704070800;Bulawayo;8.9\n" + // 01:00
+		"Hamburg;2.0\n" + // no timestamp
+		"-1;Abha;5.0" // 1969-12-31T23:00:00Z
+	if err := os.WriteFile(path, []byte(measurements), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	windows, err := AggregateWindows(context.Background(), path, time.Hour, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"0001-01-01T00:00:00Z": "{Hamburg=2.0/2.0/2.0}\n", // NoBucket
+		"1969-12-31T23:00:00Z": "{Abha=5.0/5.0/5.0}\n",
+		"2024-01-01T00:00:00Z": "{Hamburg=-3.4/4.3/12.0}\n",
+		"2024-01-01T01:00:00Z": "{Bulawayo=8.9/8.9/8.9, Hamburg=1.0/1.0/1.0}\n",
+	}
+	if len(windows) != len(want) {
+		t.Errorf("got %d windows, want %d", len(windows), len(want))
+	}
+	for bucket, table := range windows {
+		var buf bytes.Buffer
+		printCities(&buf, table)
+		if key := bucket.Format(time.RFC3339); buf.String() != want[key] {
+			t.Errorf("%s: got %q, want %q", key, buf.String(), want[key])
+		}
+	}
+
+	// filters apply per station across all windows
+	windows, err = AggregateWindows(context.Background(), path, time.Hour, Options{
+		Filter: &stats.Filter{Include: stats.Rules{Prefixes: []string{"Ham", "Bul"}}, Exclude: stats.Rules{Names: map[string]bool{"Bulawayo": true}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(windows) != 3 || len(windows[time.Unix(1704070800, 0).UTC()]) != 1 || windows[time.Unix(1704067200, 0).UTC()]["Hamburg"].Count != 2 || windows[NoBucket]["Hamburg"].Count != 1 {
+		t.Errorf("filtered: got %v", windows)
+	}
+
+	// quoted names after the timestamp
+	if err := os.WriteFile(path, []byte("1704067200;\"Washington; DC\";12.0\n1704067201;Hamburg;1.0\n1704067202;\"Washington; DC\";2.0\n\"Washington; DC\";3.0\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	windows, err = AggregateWindows(context.Background(), path, time.Hour, Options{Quoted: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	printCities(&buf, windows[time.Unix(1704067200, 0).UTC()])
+	if want := "{Hamburg=1.0/1.0/1.0, Washington; DC=2.0/7.0/12.0}\n"; len(windows) != 2 || buf.String() != want || windows[NoBucket]["Washington; DC"].Count != 1 {
+		t.Errorf("quoted: got %d windows and %q, want %q", len(windows), buf.String(), want)
+	}
+
+	// normalized names
+	if err := os.WriteFile(path, []byte("1704067200;HAMBURG;12.0\n1704067201;Hamburg;1.0\n1704070800;hamburg;2.0\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	windows, err = AggregateWindows(context.Background(), path, time.Hour, Options{Normalize: stats.Normalization{Fold: true}.Apply})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for bucket, count := range map[int64]uint{1704067200: 2, 1704070800: 1} {
+		if table := windows[time.Unix(bucket, 0).UTC()]; len(table) != 1 || table["hamburg"] == nil || table["hamburg"].Count != count {
+			t.Errorf("normalized: got %v at %d", table, bucket)
+		}
+	}
+
+	if _, err := AggregateWindows(context.Background(), path, time.Hour, Options{Separator: ','}); err == nil {
+		t.Error("expected an error for a separator")
+	}
+
+	// bad timestamps, lines without a temperature or without even a ';' are errors naming the line instead of panics
+	for _, second := range []string{"yesterday;Hamburg;1.0\n", "1704067201;Hamburg\n", "1704067201;Hamburg\n1704067202;Hamburg;1.0\n", "1704067201;Ham;burg;1.0\n", "Hamburg\n", "garbage"} {
+		if err := os.WriteFile(path, []byte("1704067200;Hamburg;12.0\n"+second), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := AggregateWindows(context.Background(), path, time.Hour, Options{}); err == nil || !strings.Contains(err.Error(), "line 2") {
+			t.Errorf("%q: expected an error for line 2, got %v", second, err)
+		}
+	}
+}
+
+// ==================================================================================== //
+// Filter
+// ==================================================================================== //
+
+func Test_Filter(t *testing.T) {
+	sample := filepath.Join(t.TempDir(), "measurements.txt")
+	f, err := os.Create(sample)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rng := rand.New(rand.NewPCG(1, 2))
+	if err := difftest.Generate(f, rng, difftest.Names(rng, 2000), 50_000); err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+
+	all, err := Aggregate(context.Background(), sample, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rules := func(rules ...string) stats.Rules {
+		var r stats.Rules
+		for _, rule := range rules {
+			if err := r.Add(rule); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return r
+	}
+
+	// every other station by name
+	var every2nd stats.Rules
+	for i, name := range slices.Sorted(maps.Keys(all)) {
+		if i%2 == 0 {
+			every2nd.Add("name:" + name)
+		}
+	}
+
+	filters := []stats.Filter{
+		{Include: every2nd},
+		{Exclude: every2nd},
+		{Include: rules("prefix:A", "prefix:B")},
+		{Exclude: rules("prefix:A", "regexp:a$")},
+		{Include: rules("regexp:^[A-M]"), Exclude: rules("name:Abha", "name:Bonn", "prefix:C")},
+		{Exclude: rules("regexp:.")},
+		{Include: rules("regexp:^\\p{Lu}"), Exclude: rules("regexp:[aeiou]{2}")},
+	}
+	for _, f := range filters {
+		want := stats.Table{}
+		for name, s := range all {
+			if f.Keep(name) {
+				want[name] = s
+			}
+		}
+
+		got, err := Aggregate(context.Background(), sample, Options{Filter: &f})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var wantBuf, gotBuf bytes.Buffer
+		printCities(&wantBuf, want)
+		printCities(&gotBuf, got)
+		if wantBuf.String() != gotBuf.String() {
+			t.Errorf("%+v: got %d stations, want %d", f, len(got), len(want))
+		}
+	}
+}
+
+// ==================================================================================== //
+// Precision
+// ==================================================================================== //
+
+func Test_Digits(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "measurements.txt")
+	write := func(s string) {
+		if err := os.WriteFile(path, []byte(s), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	hundredths := Options{ParseTemp: func(b []byte) (int, int, bool) { return parse.Fixed(b, 2) }}
+
+	write("Hamburg;12.34\nAbha;-0.05\nHamburg;-3.01")
+	stations, err := Aggregate(context.Background(), path, hundredths)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h := *stations["Hamburg"]; h != (stats.Station{Min: -301, Max: 1234, Sum: 933, Count: 2}) {
+		t.Errorf("Hamburg = %+v", h)
+	}
+	if a := *stations["Abha"]; a != (stats.Station{Min: -5, Max: -5, Sum: -5, Count: 1}) {
+		t.Errorf("Abha = %+v", a)
+	}
+
+	write("Hamburg;12.34\nAbha;1.5\n")
+	defer func() {
+		if r := recover(); r == nil || !strings.Contains(fmt.Sprint(r), "line 2") {
+			t.Errorf("expected a panic for line 2, got %v", r)
+		}
+	}()
+	_, _ = Aggregate(context.Background(), path, hundredths)
+}
+
+// ==================================================================================== //
+// Wide Range
+// ==================================================================================== //
+
+func Test_WideRange(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "measurements.txt")
+
+	// the spec data in front makes it pick the fast parser with fallback
+	spec, _ := os.ReadFile("../samples/measurements-20.txt")
+	for _, measurements := range []string{
+		"Furnace;142.7\nFreezer;-273.1\nFurnace;1200.0\nFreezer;-12.5",
+		string(spec) + "Furnace;142.7\nFreezer;-273.1\nFurnace;1200.0\nFreezer;-12.5",
+	} {
+		if err := os.WriteFile(path, []byte(measurements), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		stations, err := Aggregate(context.Background(), path, Options{WideRange: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f := *stations["Furnace"]; f != (stats.Station{Min: 1427, Max: 12000, Sum: 13427, Count: 2}) {
+			t.Errorf("Furnace = %+v", f)
+		}
+		if f := *stations["Freezer"]; f != (stats.Station{Min: -2731, Max: -125, Sum: -2856, Count: 2}) {
+			t.Errorf("Freezer = %+v", f)
+		}
+	}
+
+	// spec data is the same either way
+	want, _ := os.ReadFile("../samples/measurements-20.out")
+	stations, err := Aggregate(context.Background(), "../samples/measurements-20.txt", Options{WideRange: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	printCities(&buf, stations)
+	if buf.String() != string(want) {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+}
+
+// ==================================================================================== //
+// Fields
+// ==================================================================================== //
+
+func Test_Fields(t *testing.T) {
+	measurements, _ := os.ReadFile("../samples/measurements-20.txt")
+	expected, _ := os.ReadFile("../samples/measurements-20.out")
+
+	// "id<sep>temp<sep>station<sep>country" instead of "station;temp"
+	reorder := func(sep string) []byte {
+		var b []byte
+		for i, line := range strings.Split(strings.TrimSuffix(string(measurements), "\n"), "\n") {
+			station, temp, _ := strings.Cut(line, ";")
+			b = fmt.Appendf(b, "%d%s%s%s%s%sXX\n", i, sep, temp, sep, station, sep)
+		}
+		return b
+	}
+
+	path := filepath.Join(t.TempDir(), "measurements.txt")
+	for _, sep := range []byte{',', '\t', '|'} {
+		if err := os.WriteFile(path, reorder(string(sep)), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, opts := range []Options{
+			{Separator: sep, StationField: 3, TempField: 2},
+			{Separator: sep, StationField: 3, TempField: 2, WideRange: true},
+		} {
+			stations, err := Aggregate(context.Background(), path, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			printCities(&buf, stations)
+			if buf.String() != string(expected) {
+				t.Errorf("%q: got %q, want %q", sep, buf.String(), expected)
+			}
+		}
+
+		// lines split at every position
+		f := &fields{sep: sep, station: 3, temp: 2}
+		for size := maxLineLength + 1; size < 2*maxLineLength; size++ {
+			file, _ := os.Open(path)
+			sc := newStationScanner(file, size, maxLineLength)
+			sc.fields = f
+			var buf bytes.Buffer
+			printCities(&buf, aggregate(sc))
+			_ = file.Close()
+			if buf.String() != string(expected) {
+				t.Fatalf("%q with chunk size %d: got %q", sep, size, buf.String())
+			}
+		}
+	}
+
+	for _, opts := range []Options{{StationField: 2, TempField: 2}, {Separator: '.'}, {TempField: -1}} {
+		if _, err := Aggregate(context.Background(), path, opts); err == nil {
+			t.Errorf("%+v: expected an error", opts)
+		}
+	}
+}
+
+func Test_Quoted(t *testing.T) {
+	input := "\"Washington; DC\";12.0\nHamburg;-3.4\n\"The \"\"Best\"\" Place\";1.5\n\"Hamburg\";4.0\n\"Washington; DC\";-2.0\n\"\";0.5\n"
+	expected := "{=0.5/0.5/0.5, Hamburg=-3.4/0.3/4.0, The \"Best\" Place=1.5/1.5/1.5, Washington; DC=-2.0/5.0/12.0}\n"
+
+	path := filepath.Join(t.TempDir(), "measurements.txt")
+	if err := os.WriteFile(path, []byte(input), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, opts := range []Options{{Quoted: true}, {Quoted: true, WideRange: true}} {
+		stations, err := Aggregate(context.Background(), path, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		printCities(&buf, stations)
+		if buf.String() != expected {
+			t.Errorf("%+v: got %q, want %q", opts, buf.String(), expected)
+		}
+	}
+
+	// quoted fields in "id,station,temp"
+	csv := "1,\"Washington, DC\",12.0\n2,Hamburg,-3.4\n3,\"The \"\"Best\"\" Place\",1.5\n4,\"Hamburg\",4.0\n5,\"Washington, DC\",-2.0\n6,\"\",0.5\n"
+	if err := os.WriteFile(path, []byte(csv), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	stations, err := Aggregate(context.Background(), path, Options{Quoted: true, Separator: ',', StationField: 2, TempField: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	printCities(&buf, stations)
+	if want := strings.ReplaceAll(expected, "Washington; DC", "Washington, DC"); buf.String() != want {
+		t.Errorf("fields: got %q, want %q", buf.String(), want)
+	}
+
+	// lines split at every position
+	for size := maxLineLength + maxQuotesLength + 1; size < 2*(maxLineLength+maxQuotesLength); size++ {
+		sc := newStationScanner(strings.NewReader(input), size, maxLineLength+maxQuotesLength)
+		sc.quoted = true
+		var buf bytes.Buffer
+		printCities(&buf, aggregate(sc))
+		if buf.String() != expected {
+			t.Fatalf("chunk size %d: got %q", size, buf.String())
+		}
+	}
+
+	for _, bad := range []string{"\"Hamburg;12.0\n", "\"Ham\"burg;12.0\n"} {
+		if err := os.WriteFile(path, []byte(bad), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%q: expected a panic", bad)
+				}
+			}()
+			_, _ = Aggregate(context.Background(), path, Options{Quoted: true})
+		}()
+	}
+}
+
+func Test_Normalize(t *testing.T) {
+	// "München" in NFC and NFD
+	input := "München;1.0\nMu\u0308nchen;3.0\nHAMBURG;-3.4\n Hamburg ;4.0\nhamburg;1.0\nMÜNCHEN;-1.0\nBonn;2.0\n"
+
+	path := filepath.Join(t.TempDir(), "measurements.txt")
+	if err := os.WriteFile(path, []byte(input), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		opts Options
+		want string
+	}{
+		{Options{}, "{ Hamburg =4.0/4.0/4.0, Bonn=2.0/2.0/2.0, HAMBURG=-3.4/-3.4/-3.4, MÜNCHEN=-1.0/-1.0/-1.0, Mu\u0308nchen=3.0/3.0/3.0, München=1.0/1.0/1.0, hamburg=1.0/1.0/1.0}\n"},
+		{Options{Normalize: stats.Normalization{NFC: true}.Apply}, "{ Hamburg =4.0/4.0/4.0, Bonn=2.0/2.0/2.0, HAMBURG=-3.4/-3.4/-3.4, MÜNCHEN=-1.0/-1.0/-1.0, München=1.0/2.0/3.0, hamburg=1.0/1.0/1.0}\n"},
+		{Options{Normalize: stats.Normalization{NFC: true, Fold: true, Trim: true}.Apply}, "{bonn=2.0/2.0/2.0, hamburg=-3.4/0.6/4.0, münchen=-1.0/1.0/3.0}\n"},
+		// filters see the normalized names, their names and prefixes are normalized as well
+		{Options{
+			Normalize: stats.Normalization{NFC: true, Fold: true, Trim: true}.Apply,
+			Filter:    &stats.Filter{Exclude: stats.Rules{Names: map[string]bool{"München": true}}, Include: stats.Rules{Prefixes: []string{"m", "b"}}},
+		}, "{bonn=2.0/2.0/2.0}\n"},
+		{Options{
+			Normalize: stats.Normalization{Fold: true}.Apply,
+			Filter:    &stats.Filter{Include: stats.Rules{Names: map[string]bool{"Hamburg": true}}},
+		}, "{hamburg=-3.4/-1.2/1.0}\n"},
+		{Options{
+			Normalize: stats.Normalization{Fold: true, Trim: true}.Apply,
+			Filter:    &stats.Filter{Include: stats.Rules{Prefixes: []string{"BO", "HAM"}}},
+		}, "{bonn=2.0/2.0/2.0, hamburg=-3.4/0.6/4.0}\n"},
+		// trimming names doesn't trim the trailing space of prefixes
+		{Options{
+			Normalize: stats.Normalization{Trim: true}.Apply,
+			Filter:    &stats.Filter{Include: stats.Rules{Prefixes: []string{" Bo", "Ham "}}},
+		}, "{Bonn=2.0/2.0/2.0}\n"},
+	}
+	for _, tt := range tests {
+		stations, err := Aggregate(context.Background(), path, tt.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		printCities(&buf, stations)
+		if buf.String() != tt.want {
+			t.Errorf("got %q, want %q", buf.String(), tt.want)
+		}
+	}
+
+	// snapshots don't contain aliases either
+	stations := map[string]*stationData{}
+	f := newFilter(nil, stats.Normalization{Fold: true}.Apply, stations)
+	f.add(stations, "HAMBURG", 12)
+	f.add(stations, "Hamburg", 10)
+	if got := f.clone(stations); len(got) != 1 || got["hamburg"].Count != 2 {
+		t.Errorf("clone: got %v", got)
+	}
+	if f.remove(stations); len(stations) != 1 {
+		t.Errorf("remove: got %v", stations)
+	}
+}
@@ -1,8 +1,13 @@
 package run_9
 
 import (
+	"1brc/parse"
+	"bytes"
+	"context"
+	"fmt"
 	"io"
-	"os"
+	"slices"
+	"time"
 	"unsafe"
 )
 
@@ -11,71 +16,184 @@ import (
 // ==================================================================================== //
 
 type StationScanner struct {
-	f *os.File
+	f io.Reader
 
 	chunk []byte
 	start int
 	end   int
 
+	// maxLineLength must be > the longest line, see the package constant
+	maxLineLength int
+
 	eof bool
+
+	read     int64 // bytes read from f
+	rows     int64
+	progress *progressReporter // nil if not reported
+
+	ctx context.Context // nil if not cancelable
+	err error           // why scanning stopped early
+
+	follow time.Duration // poll interval at EOF, 0 if the file isn't followed
+	tick   func() error  // called on every refill, an error stops scanning
+
+	parseTemp func(b []byte) (temp int, n int, ok bool) // nil for [parse.Temp]
+	fields    *fields                                   // nil for "station;temp"
+	quoted    bool                                      // station names may be quoted
 }
 
-func newStationScanner(f *os.File) *StationScanner {
+// newStationScanner creates a scanner with a buffer of size bytes.
+// size must be > maxLine, usually chunkSize and maxLineLength are used.
+func newStationScanner(f io.Reader, size, maxLine int) *StationScanner {
 	return &StationScanner{
-		f:     f,
-		chunk: make([]byte, chunkSize),
+		f:             f,
+		chunk:         make([]byte, size),
+		maxLineLength: maxLine,
 	}
 }
 
-// intTemp converts the second part of a line to int.
-// "-77.7" => -777
-// "77.7" => 777
-func (s *StationScanner) intTemp(bs []byte) int {
-	neg := bs[0] == '-'
-	if neg {
-		bs = bs[1:]
+// newBytesScanner scans the lines of b in place instead of copying them into chunks.
+// b is only read, a copy is made if the last line isn't terminated by '\n'.
+func newBytesScanner(b []byte) *StationScanner {
+	if len(b) > 0 && b[len(b)-1] != '\n' {
+		b = append(slices.Clip(b), '\n')
+	}
+	return &StationScanner{
+		chunk:         b,
+		end:           len(b),
+		eof:           true, // nothing to read, so updateChunk never touches chunk
+		maxLineLength: maxLineLength,
 	}
+}
 
-	var res int
-	if bs[1] == '.' {
-		res = int(bs[0]-48)*10 + int(bs[2]-48)
-	} else { // bs[2] == '.'
-		res = int(bs[0]-48)*100 + int(bs[1]-48)*10 + int(bs[3]-48)
+func (s *StationScanner) updateChunk() {
+	if s.end-s.start >= s.maxLineLength || s.eof {
+		return // still at least one whole line left in s.chunk or nothing left to read
 	}
 
-	if neg {
-		return -res
+	if s.ctx != nil {
+		if err := s.ctx.Err(); err != nil {
+			s.stop(err)
+			return
+		}
 	}
-	return res
-}
 
-func (s *StationScanner) updateChunk() {
-	if s.end-s.start >= maxLineLength && !s.eof {
-		return // still at least one whole line left in s.chunk
+	if s.follow > 0 {
+		s.updateFollow()
+		return
+	}
+
+	if s.tick != nil {
+		if err := s.tick(); err != nil {
+			s.stop(err)
+			return
+		}
+	}
+
+	s.compact()
+
+	// a single read may return less than a line, e.g. the last one of a file without '\n' before io.EOF
+	for s.end-s.start < s.maxLineLength && !s.eof {
+		n, err := s.f.Read(s.chunk[s.end:])
+		if err == io.EOF {
+			s.eof = true
+		}
+		if err != nil && err != io.EOF {
+			s.stop(err)
+			return
+		}
+		s.end += n
+		s.read += int64(n)
+	}
+
+	// terminate the last line if the file doesn't end with '\n', there is room since s.end-s.start < maxLineLength
+	if s.eof && s.start < s.end && s.chunk[s.end-1] != '\n' {
+		s.chunk[s.end] = '\n'
+		s.end++
+	}
+
+	if s.progress != nil {
+		s.progress.update(s.consumed(), s.rows, false)
 	}
+}
+
+// consumed returns the offset in f up to which all lines are processed.
+func (s *StationScanner) consumed() int64 {
+	return s.read - int64(s.end-s.start)
+}
 
+// compact moves the unprocessed bytes to the start of a new chunk.
+func (s *StationScanner) compact() {
 	// backup necessary to be able to use unsafe in [Line]
 	backup := s.chunk
-	s.chunk = make([]byte, chunkSize)
+	s.chunk = make([]byte, len(backup))
 	copy(s.chunk, backup)
 
 	copy(s.chunk[:], s.chunk[s.start:s.end])
 	s.end = s.end - s.start
 	s.start = 0
+}
 
-	n, err := s.f.Read(s.chunk[s.end:])
-	if err == io.EOF {
-		s.eof = true
-	}
-	if err != nil && err != io.EOF {
-		panic(err)
+// updateFollow replaces updateChunk when following a growing file.
+// Instead of stopping at EOF it waits until there is at least one complete line.
+// New bytes are read behind s.end as long as there is room, so waiting doesn't allocate new chunks.
+func (s *StationScanner) updateFollow() {
+	for {
+		if len(s.chunk)-s.end < s.maxLineLength {
+			s.compact()
+		}
+
+		n, err := s.f.Read(s.chunk[s.end:])
+		if err != nil && err != io.EOF {
+			s.stop(err)
+			return
+		}
+		s.end += n
+		s.read += int64(n)
+
+		if s.tick != nil {
+			if err := s.tick(); err != nil {
+				s.stop(err)
+				return
+			}
+		}
+		if s.progress != nil {
+			s.progress.update(s.consumed(), s.rows, false)
+		}
+
+		if bytes.IndexByte(s.chunk[s.start:s.end], '\n') != -1 {
+			return
+		}
+
+		if n == 0 { // EOF and no complete line, wait for the file to grow
+			select {
+			case <-s.ctx.Done():
+				s.stop(s.ctx.Err())
+				return
+			case <-time.After(s.follow):
+			}
+		}
 	}
-	s.end += n
 }
 
 func (s *StationScanner) Next() bool {
 	s.updateChunk()
-	return !s.eof || s.start < s.end
+	if !s.eof || s.start < s.end {
+		return true
+	}
+
+	if s.progress != nil && s.err == nil {
+		s.progress.update(s.read, s.rows, true)
+	}
+	return false
+}
+
+// stop ends scanning early, the lines left in s.chunk are dropped.
+func (s *StationScanner) stop(err error) {
+	s.err = err
+	s.eof = true
+	s.read = s.consumed()
+	s.start = s.end
 }
 
 func indexByte(b []byte, c byte) int {
@@ -91,6 +209,13 @@ func indexByte(b []byte, c byte) int {
 // Line takes the current chunk and processes the first line in it.
 // s.start is advanced by the bytes used/processed.
 func (s *StationScanner) Line() (name string, temp int) {
+	if s.fields != nil {
+		return s.lineFields()
+	}
+	if s.quoted && s.chunk[s.start] == '"' {
+		return s.lineQuoted()
+	}
+
 	lines := s.chunk[s.start:]
 
 	l := indexByte(lines, ';')
@@ -98,17 +223,17 @@ func (s *StationScanner) Line() (name string, temp int) {
 	bName := lines[:l]
 	name = unsafe.String(unsafe.SliceData(bName), len(bName))
 
-	switch {
-	case lines[l+4] == '\n': // 1.2
-		s.start += l + 5 // increment the start position by the bytes used
-		return name, s.intTemp(lines[l+1 : l+4])
-	case lines[l+5] == '\n': // 12.3 or -1.2
-		s.start += l + 6
-		return name, s.intTemp(lines[l+1 : l+5])
-	case lines[l+6] == '\n': // -12.3
-		s.start += l + 7
-		return name, s.intTemp(lines[l+1 : l+6])
-	default:
-		panic("not a line")
+	var n int
+	if s.parseTemp == nil {
+		temp, n = parse.Temp(lines[l+1:])
+	} else {
+		var ok bool
+		if temp, n, ok = s.parseTemp(lines[l+1 : s.end-s.start]); !ok {
+			panic(fmt.Sprintf("line %d: invalid temperature %q", s.rows+1, lines[l+1:l+1+n]))
+		}
 	}
+	s.start += l + n + 2 // increment the start position by the bytes used incl. ';' and '\n'
+	s.rows++
+
+	return name, temp
 }
@@ -0,0 +1,42 @@
+package run_9
+
+import (
+	"1brc/parse"
+	"bytes"
+	"io"
+)
+
+// ==================================================================================== //
+// Wide Range
+// ==================================================================================== //
+
+// sampleSize is how much of a file is looked at to pick the parser for a wide range of temperatures
+const sampleSize = 64 * KB
+
+// wideParser picks the parser for a file with temperatures beyond -99.9..99.9 by its first lines after offset.
+// If they are all in the range of the challenge [parse.TempWide] is used, which takes the fast path as long as possible,
+// otherwise the file is expected to be full of wide temperatures and [parse.Fixed] is used right away.
+func wideParser(f io.ReaderAt, offset int64, fields *fields) func(b []byte) (int, int, bool) {
+	sample := make([]byte, sampleSize)
+	n, _ := f.ReadAt(sample, offset)
+	sample = sample[:n]
+
+	for {
+		i := bytes.IndexByte(sample, '\n')
+		if i == -1 {
+			return parse.TempWide
+		}
+		line := sample[:i]
+		sample = sample[i+1:]
+
+		temp := line
+		if fields != nil {
+			_, temp, _, _ = fields.split(line)
+		} else if l := bytes.LastIndexByte(line, ';'); l != -1 {
+			temp = line[l+1:]
+		}
+		if !parse.Valid(temp) {
+			return func(b []byte) (int, int, bool) { return parse.Fixed(b, 1) }
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package run_9
+
+import (
+	"1brc/parse"
+	"1brc/stats"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+	"unsafe"
+)
+
+// ==================================================================================== //
+// Time Windows
+// ==================================================================================== //
+
+// maxTimestampLength is the longest timestamp incl. ';', e.g. "2006-01-02T15:04:05.999999999+07:00;"
+const maxTimestampLength = 40
+
+// windowKey identifies the stations of one bucket
+type windowKey struct {
+	bucket int64 // start in unix seconds
+	name   string
+	timed  bool // false for lines without a timestamp
+}
+
+// NoBucket is the bucket of the lines without a timestamp in the result of [AggregateWindows].
+// It's the zero time, which sorts before any other bucket.
+var NoBucket = time.Time{}
+
+// AggregateWindows reads measurements with an optional leading timestamp "timestamp;name;temp"
+// and aggregates them per bucket, i.e. per minute, hour or day. Lines "name;temp" without a timestamp are aggregated in [NoBucket].
+// The timestamp is either in unix seconds or RFC 3339, buckets start at multiples of bucket since the unix epoch in UTC.
+// Unlike [Aggregate] every line is checked, as a line with a timestamp but no temperature would otherwise be taken for one without a timestamp.
+// Only opts.Progress, opts.ParseTemp, opts.WideRange, opts.Filter, opts.Normalize and opts.Quoted are supported.
+func AggregateWindows(ctx context.Context, filepath string, bucket time.Duration, opts Options) (map[time.Time]stats.Table, error) {
+	if bucket < time.Second {
+		return nil, fmt.Errorf("bucket %s is shorter than a second", bucket)
+	}
+	if opts.Follow || opts.Checkpoint != "" {
+		return nil, errors.New("following and checkpoints are not supported with time windows")
+	}
+	if opts.Separator != 0 || opts.StationField != 0 || opts.TempField != 0 {
+		return nil, errors.New("other separators and fields are not supported with time windows")
+	}
+
+	file, err := os.Open(filepath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.WideRange && opts.ParseTemp == nil {
+		opts.ParseTemp = wideParser(file, 0, nil)
+	}
+
+	maxLine := maxLineLength + maxTimestampLength + maxTempLength
+	if opts.Quoted {
+		maxLine += maxQuotesLength
+	}
+	scanner := newStationScanner(file, chunkSize, maxLine)
+	scanner.ctx = ctx
+	scanner.parseTemp = opts.ParseTemp
+	scanner.quoted = opts.Quoted
+	if opts.Progress != nil {
+		scanner.progress = newProgressReporter(opts.Progress, opts.ProgressInterval, info.Size())
+	}
+
+	var filter *filter
+	if opts.Filter != nil || opts.Normalize != nil {
+		filter = newFilter(opts.Filter, opts.Normalize, make(map[string]*stationData))
+	}
+
+	windows := make(map[windowKey]*stationData, maxStationCount)
+	err = aggregateWindowsInto(scanner, int64(bucket/time.Second), windows, filter)
+
+	tables := make(map[time.Time]stats.Table)
+	for key, c := range windows {
+		t := NoBucket
+		if key.timed {
+			t = time.Unix(key.bucket, 0).UTC()
+		}
+		if tables[t] == nil {
+			tables[t] = make(stats.Table)
+		}
+		tables[t][key.name] = c
+	}
+
+	if err != nil {
+		return tables, err
+	}
+	return tables, scanner.err
+}
+
+// resolved is what a [filter] decided about a station.
+type resolved struct {
+	name string
+	keep bool
+}
+
+// aggregateWindowsInto adds the lines of scanner to windows.
+// The filter may be nil, otherwise its decisions and normalized names are kept per name, as the windows are keyed by bucket as well.
+func aggregateWindowsInto(scanner *StationScanner, bucket int64, windows map[windowKey]*stationData, filter *filter) error {
+	names := make(map[string]resolved)
+	for scanner.Next() {
+		ts, timed, err := scanner.timestamp()
+		if err != nil {
+			return err
+		}
+		name, temp := scanner.Line()
+
+		if filter != nil {
+			r, ok := names[name]
+			if !ok {
+				r.name, r.keep = filter.resolve(name)
+				names[name] = r
+			}
+			if !r.keep {
+				continue
+			}
+			name = r.name
+		}
+
+		key := windowKey{name: name}
+		if timed {
+			offset := ts % bucket
+			if offset < 0 { // before 1970
+				offset += bucket
+			}
+			key.bucket, key.timed = ts-offset, true
+		}
+
+		if c, ok := windows[key]; ok { // update stationData
+			c.Max = max(c.Max, temp)
+			c.Min = min(c.Min, temp)
+			c.Sum += temp
+			c.Count++
+		} else { // add stationData
+			windows[key] = &stationData{
+				Min:   temp,
+				Max:   temp,
+				Sum:   temp,
+				Count: 1,
+			}
+		}
+	}
+	return nil
+}
+
+// timestamp parses the optional leading timestamp of the current line in unix seconds
+// and advances s.start to the station name, so [StationScanner.Line] can follow.
+// A line "timestamp;name;temp" has two ';', a line "name;temp" one and timed is false for it.
+// The temperature is checked as well, a line "timestamp;name" would otherwise be read as "name;temp".
+// Quoted names may contain ';', so they are told apart by the '"' at the start of the line or after the first ';'.
+func (s *StationScanner) timestamp() (ts int64, timed bool, err error) {
+	line := s.chunk[s.start:s.end]
+	if n := bytes.IndexByte(line, '\n'); n != -1 {
+		line = line[:n]
+	}
+	first, last := bytes.IndexByte(line, ';'), bytes.LastIndexByte(line, ';')
+	if first == -1 {
+		return 0, false, fmt.Errorf("line %d: missing ';' in %q", s.rows+1, line)
+	}
+	if !s.validTemp(line[last+1:]) {
+		return 0, false, fmt.Errorf("line %d: invalid temperature %q", s.rows+1, line[last+1:])
+	}
+
+	quoted := s.quoted && line[first+1] == '"' // the temperature isn't empty, so there is a byte after the first ';'
+	switch {
+	case first == last, s.quoted && line[0] == '"':
+		return 0, false, nil
+	case !quoted && bytes.IndexByte(line[first+1:last], ';') != -1:
+		return 0, false, fmt.Errorf("line %d: too many ';' in %q", s.rows+1, line)
+	}
+
+	b := line[:first]
+	str := unsafe.String(unsafe.SliceData(b), len(b))
+	s.start += first + 1
+
+	if ts, err := strconv.ParseInt(str, 10, 64); err == nil {
+		return ts, true, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, str)
+	if err != nil {
+		return 0, false, fmt.Errorf("line %d: invalid timestamp: %w", s.rows+1, err)
+	}
+	return t.Unix(), true, nil
+}
+
+// validTemp reports if b is a temperature the scanner's parser accepts.
+func (s *StationScanner) validTemp(b []byte) bool {
+	if s.parseTemp == nil {
+		return parse.Valid(b)
+	}
+	_, _, ok := s.parseTemp(b)
+	return ok
+}
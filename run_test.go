@@ -11,9 +11,9 @@ import (
 	"1brc/run_7"
 	"1brc/run_8"
 	"1brc/run_9"
+	"1brc/runs"
 	"bytes"
 	"crypto/md5"
-	"io"
 	"os"
 	"path/filepath"
 	"strings"
@@ -97,19 +97,6 @@ func BenchmarkConcurrent1(b *testing.B) {
 // ==================================================================================== //
 
 func TestAll(t *testing.T) {
-	funcsToTest := []func(io.Writer, string){
-		concurrent_1.Entrypoint,
-		run_1.Entrypoint,
-		run_2.Entrypoint,
-		run_3.Entrypoint,
-		run_4.Entrypoint,
-		run_5.Entrypoint,
-		run_6.Entrypoint,
-		run_7.Entrypoint,
-		run_8.Entrypoint,
-		run_9.Entrypoint,
-	}
-
 	matches, _ := filepath.Glob("samples/*.txt")
 	t.Logf("testing with files: %v \n", matches)
 
@@ -120,18 +107,18 @@ func TestAll(t *testing.T) {
 		expectedb, _ := os.ReadFile(expectedPath)
 		expected := md5.Sum(expectedb)
 
-		for i, fun := range funcsToTest {
-			t.Logf("\t testing run: %d", i+1)
+		for _, impl := range runs.All {
+			t.Logf("\t testing run: %s", impl.Name)
 
 			var buf bytes.Buffer
-			fun(&buf, match)
+			impl.Entrypoint(&buf, match)
 
 			res := md5.Sum(buf.Bytes())
 
 			if expected != res {
-				t.Logf("\t\t run_%d failed", i+1)
+				t.Logf("\t\t %s failed", impl.Name)
 				t.Logf("\t\t produced hash %x expected %x \n", res, expected)
-				t.Logf("\t\t produced %s \n", buf.String())
+				reportDiff(t, impl.Name, expectedb, buf.Bytes())
 				t.Fail()
 			}
 		}
@@ -0,0 +1,61 @@
+package runs
+
+import (
+	"1brc/concurrent_1"
+	"1brc/run_1"
+	"1brc/run_2"
+	"1brc/run_3"
+	"1brc/run_4"
+	"1brc/run_5"
+	"1brc/run_6"
+	"1brc/run_7"
+	"1brc/run_8"
+	"1brc/run_9"
+	"1brc/stats"
+	"context"
+	"io"
+)
+
+// Impl is one solution to the challenge.
+type Impl struct {
+	Name       string
+	Entrypoint func(w io.Writer, filepath string)
+
+	// Aggregate is only set for solutions which can be stopped early and return the stations instead of printing them.
+	Aggregate func(ctx context.Context, filepath string) (stats.Table, error)
+}
+
+// All holds every solution in the order they were written.
+var All = []Impl{
+	{"run_1", run_1.Entrypoint, nil},
+	{"run_2", run_2.Entrypoint, nil},
+	{"run_3", run_3.Entrypoint, nil},
+	{"run_4", run_4.Entrypoint, nil},
+	{"run_5", run_5.Entrypoint, nil},
+	{"run_6", run_6.Entrypoint, nil},
+	{"run_7", run_7.Entrypoint, nil},
+	{"run_8", run_8.Entrypoint, nil},
+	{"run_9", run_9.Entrypoint, func(ctx context.Context, filepath string) (stats.Table, error) {
+		return run_9.Aggregate(ctx, filepath, run_9.Options{})
+	}},
+	{"concurrent_1", concurrent_1.Entrypoint, concurrent_1.Aggregate},
+}
+
+// Lookup finds a solution by its name, e.g. "run_9".
+func Lookup(name string) (Impl, bool) {
+	for _, impl := range All {
+		if impl.Name == name {
+			return impl, true
+		}
+	}
+	return Impl{}, false
+}
+
+// Names returns the names of all solutions.
+func Names() []string {
+	names := make([]string, len(All))
+	for i, impl := range All {
+		names[i] = impl.Name
+	}
+	return names
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// peakRSS is not available outside of unix.
+func peakRSS(ps *os.ProcessState) int64 {
+	return 0
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"1brc/run_9"
+	"1brc/runs"
+	"1brc/stats"
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// ==================================================================================== //
+// Serve
+// ==================================================================================== //
+// go run . serve -addr :8080
+// curl --data-binary @measurements_1b.txt 'localhost:8080/aggregate?impl=run_9&format=json'
+// curl --data-binary $'Hamburg;12.0\nBulawayo;8.9\n' localhost:8080/stations
+// curl localhost:8080/stations/Hamburg
+// curl localhost:8080/metrics
+
+func serve(args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := fs.String("addr", ":8080", "address to listen on")
+	maxBody := fs.Int64("max-body", 1<<30, "largest accepted request body in bytes")
+	maxStations := fs.Int("max-stations", 10_000, "most stations a request may contain")
+	_ = fs.Parse(args)
+
+	s := newServer(*maxBody, *maxStations)
+	log.Printf("listening on %s", *addr)
+	log.Fatal(http.ListenAndServe(*addr, s.handler()))
+}
+
+// server runs the solutions on the bodies of requests
+// and keeps live stations which are added to by every POST /stations.
+type server struct {
+	maxBody     int64
+	maxStations int
+
+	live *run_9.Live
+
+	// for /metrics
+	rows, bytes, parseErrors atomic.Uint64
+}
+
+func newServer(maxBody int64, maxStations int) *server {
+	live := run_9.NewLive()
+	live.MaxStations = maxStations
+	return &server{maxBody: maxBody, maxStations: maxStations, live: live}
+}
+
+func (s *server) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /aggregate", s.aggregate)
+	mux.HandleFunc("POST /stations", s.addStations)
+	mux.HandleFunc("GET /stations", s.getStations)
+	mux.HandleFunc("GET /stations/{name}", s.getStation)
+	mux.HandleFunc("GET /metrics", s.metrics)
+	return mux
+}
+
+// output is how stations are written in a response.
+type output struct {
+	json bool
+	selection
+}
+
+// requestOutput returns the output requested by the query, ?format=json|classic (or the Accept header),
+// ?top=k or ?bottom=k with ?by=mean|min|max|count|range, ?sort=name|collate:de|max|-max
+// and ?unit=C|F|K of the measurements in ?input-unit=C|F|K.
+func requestOutput(r *http.Request) (output, error) {
+	o := output{selection: selection{conv: challenge}}
+	q := r.URL.Query()
+	switch f := q.Get("format"); f {
+	case "json":
+		o.json = true
+	case "classic":
+	case "":
+		o.json = strings.Contains(r.Header.Get("Accept"), "application/json")
+	default:
+		return o, fmt.Errorf("unknown format %q", f)
+	}
+
+	for _, p := range []struct {
+		name string
+		k    *int
+	}{{"top", &o.top}, {"bottom", &o.bottom}} {
+		if v := q.Get(p.name); v != "" {
+			k, err := strconv.Atoi(v)
+			if err != nil || k <= 0 {
+				return o, fmt.Errorf("%s must be a positive number, not %q", p.name, v)
+			}
+			*p.k = k
+		}
+	}
+	if err := o.check(); err != nil {
+		return o, err
+	}
+	if by := q.Get("by"); by != "" {
+		var err error
+		if o.by, err = stats.ParseStat(by); err != nil {
+			return o, err
+		}
+	}
+	if order := q.Get("sort"); order != "" {
+		var err error
+		if o.order, err = stats.ParseOrder(order); err != nil {
+			return o, err
+		}
+	}
+	for _, p := range []struct {
+		name string
+		unit *stats.Unit
+	}{{"input-unit", &o.conv.From}, {"unit", &o.conv.To}} {
+		if v := q.Get(p.name); v != "" {
+			var err error
+			if *p.unit, err = stats.ParseUnit(v); err != nil {
+				return o, err
+			}
+		}
+	}
+	return o, nil
+}
+
+func (o output) write(w http.ResponseWriter, t stats.Table) {
+	if o.json {
+		w.Header().Set("Content-Type", "application/json")
+		_ = stats.WriteJSON(w, o.records(t))
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_ = stats.PrintRecords(w, o.records(t))
+}
+
+// bodyError responds to an error reading the request body.
+func bodyError(w http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		http.Error(w, fmt.Sprintf("body larger than %d bytes", tooLarge.Limit), http.StatusRequestEntityTooLarge)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusBadRequest)
+}
+
+// aggregate runs ?impl= (default run_9) on the body, either the raw measurements or a multipart form with a "file".
+// The result is written as in the challenge or as JSON with ?format=json or "Accept: application/json".
+func (s *server) aggregate(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("impl")
+	if name == "" {
+		name = "run_9"
+	}
+	impl, ok := runs.Lookup(name)
+	if !ok || impl.Aggregate == nil {
+		http.Error(w, fmt.Sprintf("solution %q can't be served", name), http.StatusBadRequest)
+		return
+	}
+
+	out, err := requestOutput(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// the solutions read files, so the body is spooled to a temporary one
+	file, err := os.CreateTemp("", "1brc-*.txt")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	body, err := s.body(w, r)
+	if err == nil {
+		var n int64
+		n, err = spool(file, body, s.maxStations)
+		body.Close()
+		s.bytes.Add(uint64(n))
+	}
+	switch {
+	case errors.Is(err, run_9.ErrTooManyStations):
+		http.Error(w, fmt.Sprintf("more than %d stations", s.maxStations), http.StatusUnprocessableEntity)
+		return
+	case err != nil:
+		bodyError(w, err)
+		return
+	}
+
+	cities, err := impl.Aggregate(r.Context(), file.Name())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for _, c := range cities {
+		s.rows.Add(uint64(c.Count))
+	}
+
+	out.write(w, cities)
+}
+
+// spool copies the measurements of body to file, checking every line with [run_9.ValidateLine] on the way.
+// The solutions are written for the input of the challenge and panic on malformed lines, partly in their own goroutines.
+// It stops with [run_9.ErrTooManyStations] at the first line with more than maxStations different names,
+// so the limit holds before a solution even starts.
+func spool(file io.Writer, body io.Reader, maxStations int) (n int64, err error) {
+	r := bufio.NewReaderSize(body, 64*1024)
+	w := bufio.NewWriterSize(file, 64*1024)
+	names := make(map[string]bool)
+	for i := 1; ; i++ {
+		line, err := r.ReadSlice('\n')
+		switch {
+		case errors.Is(err, bufio.ErrBufferFull):
+			return n, fmt.Errorf("line %d: longer than %d bytes", i, r.Size())
+		case err != nil && err != io.EOF:
+			return n, err // e.g. the body is too large, the line is cut off
+		}
+		if len(line) > 0 {
+			if err := run_9.ValidateLine(bytes.TrimSuffix(line, []byte("\n"))); err != nil {
+				return n, fmt.Errorf("line %d: %w", i, err)
+			}
+			if name := line[:bytes.IndexByte(line, ';')]; !names[string(name)] { // no allocation for known names
+				if len(names) == maxStations {
+					return n, fmt.Errorf("line %d: %w", i, run_9.ErrTooManyStations)
+				}
+				names[string(name)] = true
+			}
+			if _, err := w.Write(line); err != nil {
+				return n, err
+			}
+			n += int64(len(line))
+		}
+		if err == io.EOF {
+			return n, w.Flush()
+		}
+	}
+}
+
+// addStations adds the lines of the body to the live stations.
+// The body is rejected as a whole if a line is malformed or it would exceed -max-stations.
+func (s *server) addStations(w http.ResponseWriter, r *http.Request) {
+	batch, err := io.ReadAll(http.MaxBytesReader(w, r.Body, s.maxBody))
+	if err != nil {
+		bodyError(w, err)
+		return
+	}
+	s.bytes.Add(uint64(len(batch)))
+
+	rows, err := s.live.Add(batch)
+	switch {
+	case errors.Is(err, run_9.ErrTooManyStations):
+		http.Error(w, fmt.Sprintf("more than %d stations", s.maxStations), http.StatusUnprocessableEntity)
+		return
+	case err != nil:
+		s.parseErrors.Add(1)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.rows.Add(uint64(rows))
+	fmt.Fprintf(w, "added %d rows\n", rows)
+}
+
+// getStations responds with all live stations.
+func (s *server) getStations(w http.ResponseWriter, r *http.Request) {
+	out, err := requestOutput(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	out.write(w, s.live.Table())
+}
+
+// getStation responds with a single live station, as a table with one entry.
+func (s *server) getStation(w http.ResponseWriter, r *http.Request) {
+	out, err := requestOutput(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	name := r.PathValue("name")
+	station, ok := s.live.Station(name)
+	if !ok {
+		http.Error(w, fmt.Sprintf("unknown station %q", name), http.StatusNotFound)
+		return
+	}
+	out.write(w, stats.Table{name: &station})
+}
+
+// body returns the measurements of r limited to s.maxBody bytes.
+func (s *server) body(w http.ResponseWriter, r *http.Request) (io.ReadCloser, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, s.maxBody)
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		return r.Body, nil
+	}
+
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		part, err := mr.NextPart()
+		if err != nil {
+			if err == io.EOF {
+				return nil, errors.New(`missing "file" in form`)
+			}
+			return nil, err
+		}
+		if part.FormName() == "file" {
+			return part, nil
+		}
+	}
+}
+
+// metrics responds with the live stations and the work done by all requests for Prometheus.
+func (s *server) metrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_ = stats.WritePrometheus(w, s.live.Table().Records(), stats.Counters{
+		Rows:        s.rows.Load(),
+		Bytes:       s.bytes.Load(),
+		ParseErrors: s.parseErrors.Load(),
+	})
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"1brc/stats"
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func newTestServer(t *testing.T, maxBody int64, maxStations int) *httptest.Server {
+	s := httptest.NewServer(newServer(maxBody, maxStations).handler())
+	t.Cleanup(s.Close)
+	return s
+}
+
+func post(t *testing.T, url, contentType string, body []byte) (int, string) {
+	resp, err := http.Post(url, contentType, bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var b bytes.Buffer
+	_, _ = b.ReadFrom(resp.Body)
+	return resp.StatusCode, b.String()
+}
+
+func TestServeAggregate(t *testing.T) {
+	in, _ := os.ReadFile("samples/measurements-10.txt")
+	want, _ := os.ReadFile("samples/measurements-10.out")
+	s := newTestServer(t, 1<<20, 10_000)
+
+	for _, impl := range []string{"run_9", "concurrent_1"} {
+		code, got := post(t, s.URL+"/aggregate?impl="+impl, "text/plain", in)
+		if code != http.StatusOK || got != string(want) {
+			t.Errorf("%s: %d %q, want %q", impl, code, got, want)
+		}
+	}
+
+	// multipart upload
+	var form bytes.Buffer
+	mw := multipart.NewWriter(&form)
+	fw, _ := mw.CreateFormFile("file", "measurements-10.txt")
+	_, _ = fw.Write(in)
+	_ = mw.Close()
+	code, got := post(t, s.URL+"/aggregate", mw.FormDataContentType(), form.Bytes())
+	if code != http.StatusOK || got != string(want) {
+		t.Errorf("multipart: %d %q, want %q", code, got, want)
+	}
+
+	// malformed bodies are rejected before any solution sees them
+	for _, body := range []string{"garbage\n", "a;xx.y\n", "Hamburg;12.0\n;1.0\n", "a;1.0\n\n", "a;" + strings.Repeat("1", 100_000)} {
+		for _, impl := range []string{"run_9", "concurrent_1"} {
+			if code, got := post(t, s.URL+"/aggregate?impl="+impl, "text/plain", []byte(body)); code != http.StatusBadRequest {
+				t.Errorf("%s %.20q: got %d %q, want 400", impl, body, code, got)
+			}
+		}
+	}
+}
+
+func TestServeJSON(t *testing.T) {
+	s := newTestServer(t, 1<<20, 10_000)
+
+	code, got := post(t, s.URL+"/aggregate?format=json", "text/plain", []byte("b;1.0\na;-2.5\na;3.0\n"))
+	if code != http.StatusOK {
+		t.Fatalf("%d %s", code, got)
+	}
+	var records []stats.Record
+	if err := json.Unmarshal([]byte(got), &records); err != nil {
+		t.Fatal(err)
+	}
+	want := []stats.Record{
+		{Name: "a", Min: -2.5, Mean: 0.3, Max: 3.0, Count: 2, Sum: 0.5},
+		{Name: "b", Min: 1.0, Mean: 1.0, Max: 1.0, Count: 1, Sum: 1.0},
+	}
+	if len(records) != len(want) || records[0] != want[0] || records[1] != want[1] {
+		t.Errorf("got %+v, want %+v", records, want)
+	}
+}
+
+func TestServeLimits(t *testing.T) {
+	s := newTestServer(t, 16, 1)
+
+	tests := []struct {
+		name string
+		url  string
+		body string
+		code int
+	}{
+		{"ok", "/aggregate", "a;1.0\na;2.0\n", http.StatusOK},
+		{"body too large", "/aggregate", strings.Repeat("a;1.0\n", 3), http.StatusRequestEntityTooLarge},
+		{"too many stations", "/aggregate", "a;1.0\nb;2.0\n", http.StatusUnprocessableEntity},
+		{"unsupported impl", "/aggregate?impl=run_1", "a;1.0\n", http.StatusBadRequest},
+		{"unknown format", "/aggregate?format=xml", "a;1.0\n", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code, got := post(t, s.URL+tt.url, "text/plain", []byte(tt.body)); code != tt.code {
+				t.Errorf("got %d %q, want %d", code, got, tt.code)
+			}
+		})
+	}
+}
+
+func get(t *testing.T, url string) (int, string) {
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var b bytes.Buffer
+	_, _ = b.ReadFrom(resp.Body)
+	return resp.StatusCode, b.String()
+}
+
+func TestServeLive(t *testing.T) {
+	s := newTestServer(t, 1<<20, 2)
+
+	if code, got := post(t, s.URL+"/stations", "text/plain", []byte("Hamburg;12.0\nBulawayo;8.9\n")); code != http.StatusOK {
+		t.Fatalf("%d %s", code, got)
+	}
+	if code, got := post(t, s.URL+"/stations", "text/plain", []byte("Hamburg;-3.4")); code != http.StatusOK {
+		t.Fatalf("%d %s", code, got)
+	}
+
+	tests := []struct {
+		name string
+		url  string
+		code int
+		want string
+	}{
+		{"all", "/stations", http.StatusOK, "{Bulawayo=8.9/8.9/8.9, Hamburg=-3.4/4.3/12.0}\n"},
+		{"one", "/stations/Hamburg", http.StatusOK, "{Hamburg=-3.4/4.3/12.0}\n"},
+		{"json", "/stations/Hamburg?format=json", http.StatusOK, `[{"name":"Hamburg","min":-3.4,"mean":4.3,"max":12,"count":2,"sum":8.6}]` + "\n"},
+		{"unknown", "/stations/Abha", http.StatusNotFound, ""},
+		{"top", "/stations?top=1&by=min", http.StatusOK, "{Bulawayo=8.9/8.9/8.9}\n"},
+		{"bottom", "/stations?bottom=1&by=min", http.StatusOK, "{Hamburg=-3.4/4.3/12.0}\n"},
+		{"bad top", "/stations?top=x", http.StatusBadRequest, ""},
+		{"negative top", "/stations?top=-1", http.StatusBadRequest, ""},
+		{"top and bottom", "/stations?top=1&bottom=1", http.StatusBadRequest, ""},
+		{"bad by", "/stations?top=1&by=median", http.StatusBadRequest, ""},
+		{"sort", "/stations?sort=-max", http.StatusOK, "{Hamburg=-3.4/4.3/12.0, Bulawayo=8.9/8.9/8.9}\n"},
+		{"bad sort", "/stations?sort=collate:", http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, got := get(t, s.URL+tt.url)
+			if code != tt.code || (tt.want != "" && got != tt.want) {
+				t.Errorf("got %d %q, want %d %q", code, got, tt.code, tt.want)
+			}
+		})
+	}
+
+	// rejected batches don't change anything
+	for _, batch := range []string{"Abha;1.0\n", "Hamburg;1.0\nHamburg;1\n"} {
+		if code, _ := post(t, s.URL+"/stations", "text/plain", []byte(batch)); code == http.StatusOK {
+			t.Errorf("%q was accepted", batch)
+		}
+	}
+	if _, got := get(t, s.URL+"/stations/Hamburg"); got != "{Hamburg=-3.4/4.3/12.0}\n" {
+		t.Errorf("got %q after rejected batches", got)
+	}
+}
+
+func TestServeMetrics(t *testing.T) {
+	s := newTestServer(t, 1<<20, 10)
+
+	post(t, s.URL+"/stations", "text/plain", []byte("a\\\"b;-1.5\na\\\"b;3.0\n"))
+	post(t, s.URL+"/stations", "text/plain", []byte("a;1.0\na;x\n"))
+
+	_, got := get(t, s.URL+"/metrics")
+	for _, want := range []string{
+		"# TYPE brc_station_temperature_min_celsius gauge\n",
+		`brc_station_temperature_min_celsius{station="a\\\"b"} -1.5` + "\n",
+		`brc_station_temperature_max_celsius{station="a\\\"b"} 3` + "\n",
+		`brc_station_temperature_mean_celsius{station="a\\\"b"} 0.75` + "\n",
+		`brc_station_temperature_sum_celsius{station="a\\\"b"} 1.5` + "\n",
+		`brc_station_measurements_total{station="a\\\"b"} 2` + "\n",
+		"brc_rows_parsed_total 2\n",
+		"brc_bytes_read_total 29\n",
+		"brc_parse_errors_total 1\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q in\n%s", want, got)
+		}
+	}
+
+	// rows of rejected bodies aren't counted
+	few := newTestServer(t, 1<<20, 1)
+	if code, _ := post(t, few.URL+"/aggregate", "text/plain", []byte("a;1.0\na;2.0\nb;3.0\n")); code != http.StatusUnprocessableEntity {
+		t.Errorf("got %d for too many stations", code)
+	}
+	if _, got := get(t, few.URL+"/metrics"); !strings.Contains(got, "brc_rows_parsed_total 0\n") {
+		t.Errorf("rows of a rejected body counted:\n%s", got)
+	}
+}
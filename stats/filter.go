@@ -0,0 +1,125 @@
+package stats
+
+import (
+	"bufio"
+	"fmt"
+	"maps"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Filter selects stations by name.
+// A station is kept if it matches one of the Include rules, or there are none, and none of the Exclude rules.
+type Filter struct {
+	Include, Exclude Rules
+}
+
+// Keep reports if the station name passes f.
+func (f *Filter) Keep(name string) bool {
+	return (f.Include.empty() || f.Include.Match(name)) && !f.Exclude.Match(name)
+}
+
+// Empty reports if f keeps every station.
+func (f *Filter) Empty() bool {
+	return f.Include.empty() && f.Exclude.empty()
+}
+
+// Rules match station names exactly, by prefix or by regular expression.
+type Rules struct {
+	Names    map[string]bool
+	Prefixes []string
+	Regexps  []*regexp.Regexp
+}
+
+// Add parses a rule "name:Hamburg", "prefix:Ham", "regexp:^Ham" or "file:stations.txt",
+// the latter adds every line of the file as name.
+func (r *Rules) Add(rule string) error {
+	kind, value, ok := strings.Cut(rule, ":")
+	if !ok {
+		return fmt.Errorf("rule %q is not kind:value", rule)
+	}
+
+	switch kind {
+	case "name":
+		r.addName(value)
+	case "prefix":
+		r.Prefixes = append(r.Prefixes, value)
+	case "regexp":
+		re, err := regexp.Compile(value)
+		if err != nil {
+			return err
+		}
+		r.Regexps = append(r.Regexps, re)
+	case "file":
+		f, err := os.Open(value)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		sc := bufio.NewScanner(f)
+		for sc.Scan() {
+			if sc.Text() != "" {
+				r.addName(sc.Text())
+			}
+		}
+		return sc.Err()
+	default:
+		return fmt.Errorf("unknown kind %q of rule %q, one of name, prefix, regexp or file", kind, rule)
+	}
+	return nil
+}
+
+func (r *Rules) addName(name string) {
+	if r.Names == nil {
+		r.Names = make(map[string]bool)
+	}
+	r.Names[name] = true
+}
+
+func (r *Rules) empty() bool {
+	return len(r.Names) == 0 && len(r.Prefixes) == 0 && len(r.Regexps) == 0
+}
+
+// Match reports if any rule matches name.
+func (r *Rules) Match(name string) bool {
+	if r.Names[name] {
+		return true
+	}
+	for _, p := range r.Prefixes {
+		if strings.HasPrefix(name, p) {
+			return true
+		}
+	}
+	for _, re := range r.Regexps {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// String returns the rules of f as they are given on the command line, names sorted,
+// e.g. "include name:Hamburg include prefix:Ham exclude regexp:^Ham".
+func (f *Filter) String() string {
+	var b strings.Builder
+	f.Include.write(&b, "include")
+	f.Exclude.write(&b, "exclude")
+	return strings.TrimPrefix(b.String(), " ")
+}
+
+func (r *Rules) write(b *strings.Builder, op string) {
+	for _, name := range slices.Sorted(maps.Keys(r.Names)) {
+		if r.Names[name] {
+			fmt.Fprintf(b, " %s name:%s", op, name)
+		}
+	}
+	for _, p := range r.Prefixes {
+		fmt.Fprintf(b, " %s prefix:%s", op, p)
+	}
+	for _, re := range r.Regexps {
+		fmt.Fprintf(b, " %s regexp:%s", op, re)
+	}
+}
@@ -0,0 +1,44 @@
+package stats
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// ReadGroups reads a mapping from station to group, one "station;group" per line.
+// Empty lines are skipped.
+func ReadGroups(r io.Reader) (map[string]string, error) {
+	groups := make(map[string]string)
+
+	sc := bufio.NewScanner(r)
+	for i := 1; sc.Scan(); i++ {
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		station, group, ok := bytes.Cut(sc.Bytes(), []byte(";"))
+		if !ok {
+			return nil, fmt.Errorf("line %d: missing ';'", i)
+		}
+		groups[string(station)] = string(group)
+	}
+	return groups, sc.Err()
+}
+
+// Ungrouped is the group of the stations missing from the mapping passed to [Table.RollUp].
+const Ungrouped = "(ungrouped)"
+
+// RollUp merges the stations of t into their groups.
+// Stations without a group are merged into [Ungrouped], so every measurement is part of a group.
+func (t Table) RollUp(groups map[string]string) Table {
+	rolled := make(Table)
+	for name, s := range t {
+		group, ok := groups[name]
+		if !ok {
+			group = Ungrouped
+		}
+		rolled.Add(group, s)
+	}
+	return rolled
+}
@@ -0,0 +1,11 @@
+package stats
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// WriteJSON writes records as a JSON array.
+func WriteJSON(w io.Writer, records []Record) error {
+	return json.NewEncoder(w).Encode(records)
+}
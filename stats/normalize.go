@@ -0,0 +1,35 @@
+package stats
+
+import (
+	"strings"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Normalization merges station names which only differ in their bytes, e.g. "München" in NFC and NFD.
+type Normalization struct {
+	NFC  bool // compose to Unicode normalization form C
+	Fold bool // fold the case, e.g. "HAMBURG" to "hamburg"
+	Trim bool // trim leading and trailing white space
+}
+
+// Empty reports if n keeps every name as is.
+func (n Normalization) Empty() bool {
+	return !n.NFC && !n.Fold && !n.Trim
+}
+
+// Apply returns the normalized name, names which already are are returned as is.
+// Folding may decompose runes, so the name is composed after it.
+func (n Normalization) Apply(name string) string {
+	if n.Trim {
+		name = strings.TrimSpace(name)
+	}
+	if n.Fold {
+		name = cases.Fold().String(name) // a Caser can't be shared between goroutines
+	}
+	if n.NFC {
+		name = norm.NFC.String(name)
+	}
+	return name
+}
@@ -0,0 +1,62 @@
+package stats
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+)
+
+// Order is the order records are written in.
+// The zero value orders by name in byte order as in the challenge, which puts "Ürümqi" after "Zürich".
+type Order struct {
+	Collate string // BCP 47 tag of the language whose rules names are ordered by, e.g. "de", unless ByStat
+	ByStat  bool   // ordered by Stat instead of the name
+	Stat    Stat
+	Reverse bool
+}
+
+// ParseOrder parses "name", "collate:<language>" or a statistic like "max", prefixed by '-' for the reverse order.
+func ParseOrder(s string) (Order, error) {
+	var o Order
+	s, o.Reverse = strings.CutPrefix(s, "-")
+	switch {
+	case s == "name":
+	case strings.HasPrefix(s, "collate:"):
+		o.Collate = strings.TrimPrefix(s, "collate:")
+		if _, err := language.Parse(o.Collate); err != nil {
+			return o, fmt.Errorf("order %q: %w", s, err)
+		}
+	default:
+		stat, err := ParseStat(s)
+		if err != nil {
+			return o, fmt.Errorf("unknown order %q, one of name, collate:<language> or a statistic", s)
+		}
+		o.ByStat, o.Stat = true, stat
+	}
+	return o, nil
+}
+
+// Sort sorts records in the order o, ties always by name in byte order.
+func (o Order) Sort(records []Record) {
+	byName := strings.Compare
+	if o.Collate != "" && !o.ByStat {
+		byName = collate.New(language.Make(o.Collate)).CompareString // not safe for concurrent use
+	}
+
+	slices.SortFunc(records, func(a, b Record) int {
+		var c int
+		if o.ByStat {
+			c = cmp.Compare(o.Stat.value(a.aggregates(1)), o.Stat.value(b.aggregates(1)))
+		} else {
+			c = byName(a.Name, b.Name)
+		}
+		if o.Reverse {
+			c = -c
+		}
+		return cmp.Or(c, strings.Compare(a.Name, b.Name))
+	})
+}
@@ -0,0 +1,73 @@
+package stats
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Counters describe the work done to aggregate a [Table].
+type Counters struct {
+	Rows        uint64 // lines aggregated
+	Bytes       uint64 // bytes read
+	ParseErrors uint64 // malformed lines
+
+	// RowsOnly leaves out Bytes and ParseErrors if they aren't counted,
+	// e.g. on the command line which stops at the first malformed line anyway.
+	RowsOnly bool
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// WritePrometheus writes records and c in the Prometheus text exposition format.
+// Every station is a label of the series, the unit of the temperatures is part of the name, the mean isn't rounded.
+func WritePrometheus(w io.Writer, records []Record, c Counters) error {
+	labels := make([]string, len(records))
+	for i, r := range records {
+		labels[i] = `{station="` + labelEscaper.Replace(r.Name) + `"} `
+	}
+
+	unit := Celsius.Name()
+	if len(records) > 0 {
+		unit = records[0].Unit.Name()
+	}
+
+	bw := bufio.NewWriter(w)
+	family := func(name, typ, help string, value func(r *Record) string) {
+		bw.WriteString("# HELP " + name + " " + help + "\n")
+		bw.WriteString("# TYPE " + name + " " + typ + "\n")
+		for i := range records {
+			bw.WriteString(name + labels[i])
+			bw.WriteString(value(&records[i]))
+			bw.WriteByte('\n')
+		}
+	}
+	family("brc_station_temperature_min_"+unit, "gauge", "Lowest temperature measured at the station.",
+		func(r *Record) string { return degrees(r.Min) })
+	family("brc_station_temperature_max_"+unit, "gauge", "Highest temperature measured at the station.",
+		func(r *Record) string { return degrees(r.Max) })
+	family("brc_station_temperature_mean_"+unit, "gauge", "Mean temperature measured at the station.",
+		func(r *Record) string { return degrees(r.Sum / float64(r.Count)) })
+	family("brc_station_temperature_sum_"+unit, "gauge", "Sum of all temperatures measured at the station.",
+		func(r *Record) string { return degrees(r.Sum) })
+	family("brc_station_measurements_total", "counter", "Number of measurements of the station.",
+		func(r *Record) string { return strconv.FormatUint(uint64(r.Count), 10) })
+
+	counter := func(name, help string, value uint64) {
+		bw.WriteString("# HELP " + name + " " + help + "\n")
+		bw.WriteString("# TYPE " + name + " counter\n")
+		bw.WriteString(name + " " + strconv.FormatUint(value, 10) + "\n")
+	}
+	counter("brc_rows_parsed_total", "Lines aggregated.", c.Rows)
+	if !c.RowsOnly {
+		counter("brc_bytes_read_total", "Bytes of measurements read.", c.Bytes)
+		counter("brc_parse_errors_total", "Malformed lines, a rejected batch counts once.", c.ParseErrors)
+	}
+
+	return bw.Flush()
+}
+
+func degrees(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
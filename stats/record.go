@@ -0,0 +1,113 @@
+package stats
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Record is one station of a [Table] rounded the same way as [PrintCities].
+// Records are what the output writers work on, so stations can be selected and ordered beforehand.
+type Record struct {
+	Name  string  `json:"name"`
+	Min   float64 `json:"min"`
+	Mean  float64 `json:"mean"`
+	Max   float64 `json:"max"`
+	Count uint    `json:"count"`
+	Sum   float64 `json:"sum"`            // not rounded
+	Unit  Unit    `json:"unit,omitempty"` // only set by [Convert], Celsius otherwise
+
+	station   *Station // nil if not made from a Table, see [Record.aggregates]
+	digits    int      // fractional digits written by [PrintRecords]
+	converted bool     // by [Convert] into fixed
+	fixed     [3]int64 // min, mean and max in units of 10^-digits if converted
+}
+
+func newRecord(name string, c *Station) Record {
+	return Record{
+		Name:  name,
+		Min:   ceilPrecision1(float64(c.Min) / 10),
+		Mean:  ceilPrecision1(float64(c.Sum) / 10 / float64(c.Count)),
+		Max:   ceilPrecision1(float64(c.Max) / 10),
+		Count: c.Count,
+		Sum:   float64(c.Sum) / 10,
+
+		station: c,
+		digits:  1,
+	}
+}
+
+// aggregates returns the station r was made from, or for records which weren't, e.g. literals or decoded from JSON,
+// the integers in units of 10^-digits of r's values. Only the sum isn't rounded, so the mean is exact either way.
+func (r *Record) aggregates(digits int) *Station {
+	if r.station != nil {
+		return r.station
+	}
+	p := float64(pow10(digits))
+	return &Station{
+		Min:   int(math.Round(r.Min * p)),
+		Max:   int(math.Round(r.Max * p)),
+		Sum:   int(math.Round(r.Sum * p)),
+		Count: r.Count,
+	}
+}
+
+// Records returns the stations of t sorted by name.
+func (t Table) Records() []Record {
+	records := make([]Record, 0, len(t))
+	for name, c := range t {
+		records = append(records, newRecord(name, c))
+	}
+	slices.SortFunc(records, func(a, b Record) int { return strings.Compare(a.Name, b.Name) })
+	return records
+}
+
+// PrintRecords writes records in their order in the format of [PrintCities].
+// The values are formatted from the integers they were computed from like by [PrintCities],
+// only records which weren't made from a [Table] are formatted as floats.
+func PrintRecords(w io.Writer, records []Record) error {
+	bw := bufio.NewWriterSize(w, 64*1024)
+	bw.WriteByte('{')
+	for i := range records {
+		if i > 0 {
+			bw.WriteString(", ")
+		}
+		b := bw.AvailableBuffer()
+		b = append(b, records[i].Name...)
+		b = append(b, '=')
+		b = records[i].appendValues(b)
+		bw.Write(b)
+	}
+	bw.WriteString("}\n")
+	return bw.Flush()
+}
+
+// appendValues appends "min/mean/max" the same as strconv.FormatFloat(v, 'f', r.digits, 64) of each.
+func (r *Record) appendValues(b []byte) []byte {
+	switch {
+	case r.converted && max(abs(r.fixed[0]), abs(r.fixed[1]), abs(r.fixed[2])) < maxTenths:
+		b = appendFixed(b, r.fixed[0], r.digits)
+		b = append(b, '/')
+		b = appendFixed(b, r.fixed[1], r.digits)
+		b = append(b, '/')
+		return appendFixed(b, r.fixed[2], r.digits)
+	case !r.converted && r.station != nil:
+		return appendStation(b, r.station)
+	}
+
+	b = strconv.AppendFloat(b, r.Min, 'f', r.digits, 64)
+	b = append(b, '/')
+	b = strconv.AppendFloat(b, r.Mean, 'f', r.digits, 64)
+	b = append(b, '/')
+	return strconv.AppendFloat(b, r.Max, 'f', r.digits, 64)
+}
+
+func abs(v int64) int64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,144 @@
+package stats
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const maxStationCount = 10_000
+
+// Station holds the aggregated measurements of one station in tenths of a degree.
+type Station struct {
+	Min   int
+	Max   int
+	Sum   int
+	Count uint
+}
+
+// Table maps station names to their aggregated measurements.
+type Table map[string]*Station
+
+func NewTable() Table {
+	return make(Table, maxStationCount)
+}
+
+// Clone returns a deep copy of t.
+func (t Table) Clone() Table {
+	c := make(Table, len(t))
+	for name, s := range t {
+		cs := *s
+		c[name] = &cs
+	}
+	return c
+}
+
+// Merge adds the measurements of o to t.
+// Names new to t are copied, so the names of o may point into a buffer which is reused.
+func (t Table) Merge(o Table) {
+	for name, s := range o {
+		t.Add(name, s)
+	}
+}
+
+// Add merges the measurements s into the station name of t.
+func (t Table) Add(name string, s *Station) {
+	if c, ok := t[name]; ok {
+		c.Min = min(c.Min, s.Min)
+		c.Max = max(c.Max, s.Max)
+		c.Sum += s.Sum
+		c.Count += s.Count
+	} else {
+		cs := *s
+		t[strings.Clone(name)] = &cs
+	}
+}
+
+func ceilPrecision1(val float64) float64 {
+	return math.Ceil(val*10) / 10
+}
+
+// PrintCities writes t sorted by name in the format of the challenge
+// "{Abha=-23.0/18.0/59.2, Abidjan=-16.2/26.0/67.3, ...}".
+// The numbers are appended to a buffer as integer tenths instead of formatting floats with fmt,
+// the output is the same as %.1f of ceilPrecision1 as in the solutions.
+func PrintCities(w io.Writer, t Table) {
+	keys := make([]string, 0, len(t))
+	for k := range t {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+
+	bw := bufio.NewWriterSize(w, 64*1024)
+	bw.WriteByte('{')
+	for i, key := range keys {
+		c := t[key]
+		if i > 0 {
+			bw.WriteString(", ")
+		}
+		b := bw.AvailableBuffer()
+		b = append(b, key...)
+		b = append(b, '=')
+		b = appendStation(b, c)
+		bw.Write(b)
+	}
+	bw.WriteString("}\n")
+	_ = bw.Flush()
+}
+
+// appendStation appends "min/mean/max" of c, which is what [PrintCities] and [PrintRecords] write.
+func appendStation(b []byte, c *Station) []byte {
+	b = appendTenths(b, c.Min)
+	b = append(b, '/')
+	b = appendCeil1(b, float64(c.Sum)/10/float64(c.Count))
+	b = append(b, '/')
+	return appendTenths(b, c.Max)
+}
+
+// maxTenths bounds the tenths which are formatted as integers,
+// up to it ceilPrecision1(float64(tenths)/10) is exactly tenths/10.
+const maxTenths = 100_000_000
+
+// appendTenths appends tenths like %.1f of ceilPrecision1(float64(tenths)/10).
+func appendTenths(b []byte, tenths int) []byte {
+	if tenths <= -maxTenths || tenths >= maxTenths {
+		return appendCeil1(b, float64(tenths)/10)
+	}
+	return appendFixed(b, int64(tenths), 1)
+}
+
+// appendCeil1 appends val rounded up like %.1f of ceilPrecision1(val), incl. "-0.0" for values just below 0.
+func appendCeil1(b []byte, val float64) []byte {
+	tenths := math.Ceil(val * 10)
+	switch {
+	case math.Abs(tenths) >= maxTenths:
+		return strconv.AppendFloat(b, tenths/10, 'f', 1, 64)
+	case tenths == 0 && math.Signbit(tenths):
+		return append(b, "-0.0"...)
+	}
+	return appendFixed(b, int64(tenths), 1)
+}
+
+// appendFixed appends v in units of 10^-digits with digits fractional digits,
+// the same as strconv.FormatFloat(float64(v)/10^digits, 'f', digits, 64) for |v| < maxTenths.
+func appendFixed(b []byte, v int64, digits int) []byte {
+	if v < 0 {
+		b = append(b, '-')
+		v = -v
+	}
+	if digits == 0 {
+		return strconv.AppendInt(b, v, 10)
+	}
+
+	p := pow10(digits)
+	b = strconv.AppendInt(b, v/p, 10)
+	b = append(b, '.')
+	frac := v % p
+	for d := p / 10; d > frac && d > 1; d /= 10 { // leading zeros
+		b = append(b, '0')
+	}
+	return strconv.AppendInt(b, frac, 10)
+}
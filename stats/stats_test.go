@@ -0,0 +1,402 @@
+package stats
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestRollUp(t *testing.T) {
+	groups, err := ReadGroups(strings.NewReader("Abha;Asia\n\nPalembang;Asia\nIstanbul;Europe\nNowhere;Atlantis\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	table := Table{
+		"Abha":      {Min: -42, Max: 242, Sum: 200, Count: 2},
+		"Palembang": {Min: -962, Max: -126, Sum: -1254, Count: 3},
+		"Istanbul":  {Min: -695, Max: -695, Sum: -695, Count: 1},
+		"Hamburg":   {Min: 120, Max: 120, Sum: 120, Count: 1},
+	}
+
+	var buf bytes.Buffer
+	PrintCities(&buf, table.RollUp(groups))
+	if want := "{(ungrouped)=12.0/12.0/12.0, Asia=-96.2/-21.0/24.2, Europe=-69.5/-69.5/-69.5}\n"; buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+	if table["Abha"].Count != 2 {
+		t.Errorf("RollUp modified the stations: %+v", table["Abha"])
+	}
+
+	if _, err := ReadGroups(strings.NewReader("Abha;Asia\nPalembang\n")); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("expected an error for line 2, got %v", err)
+	}
+}
+
+func TestPrintRecords(t *testing.T) {
+	table := Table{
+		"Abha":      {Min: -42, Max: 242, Sum: 200, Count: 2},
+		"Palembang": {Min: -962, Max: -126, Sum: -1254, Count: 3},
+		"Zero":      {Min: -1, Max: 0, Sum: -1, Count: 3},
+	}
+
+	var want, got bytes.Buffer
+	PrintCities(&want, table)
+	if err := PrintRecords(&got, table.Records()); err != nil {
+		t.Fatal(err)
+	}
+	if got.String() != want.String() {
+		t.Errorf("got %q, want %q", got.String(), want.String())
+	}
+}
+
+// printRecordsFloat is PrintRecords formatting the rounded floats of the records.
+func printRecordsFloat(w io.Writer, records []Record) {
+	var b []byte
+	b = append(b, '{')
+	for i, r := range records {
+		if i > 0 {
+			b = append(b, ", "...)
+		}
+		b = append(b, r.Name...)
+		b = append(b, '=')
+		b = strconv.AppendFloat(b, r.Min, 'f', r.digits, 64)
+		b = append(b, '/')
+		b = strconv.AppendFloat(b, r.Mean, 'f', r.digits, 64)
+		b = append(b, '/')
+		b = strconv.AppendFloat(b, r.Max, 'f', r.digits, 64)
+	}
+	_, _ = w.Write(append(b, "}\n"...))
+}
+
+// TestPrintRecordsConverted checks that converted records are formatted from their integers like their floats.
+func TestPrintRecordsConverted(t *testing.T) {
+	rng := rand.New(rand.NewPCG(3, 4))
+	table := randomTable(rng, 500, 3, 99_999)
+	table["Zero"] = &Station{Min: -1, Max: 0, Sum: -1, Count: 3}
+	table["Beyond"] = &Station{Min: -1 << 50, Max: 1 << 50, Sum: 0, Count: 2}
+
+	for _, from := range []Unit{Celsius, Fahrenheit, Kelvin} {
+		for _, to := range []Unit{Celsius, Fahrenheit, Kelvin} {
+			for digits := range 4 {
+				for output := range 4 {
+					records := Convert(table.Records(), Conversion{From: from, To: to, Digits: digits, OutputDigits: output})
+					var want, got bytes.Buffer
+					printRecordsFloat(&want, records)
+					if err := PrintRecords(&got, records); err != nil {
+						t.Fatal(err)
+					}
+					if got.String() != want.String() {
+						t.Fatalf("%c to %c with %d/%d digits: got %q, want %q", from, to, digits, output, got.String(), want.String())
+					}
+				}
+			}
+		}
+	}
+}
+
+// printCitiesFmt is PrintCities as in the solutions, formatting every station with fmt.
+func printCitiesFmt(w io.Writer, t Table) {
+	keys := slices.Sorted(maps.Keys(t))
+
+	_, _ = fmt.Fprint(w, "{")
+	for i, key := range keys {
+		c := t[key]
+		_, _ = fmt.Fprintf(w, "%s=%.1f/%.1f/%.1f",
+			key,
+			ceilPrecision1(float64(c.Min)/10),
+			ceilPrecision1(float64(c.Sum)/10/float64(c.Count)),
+			ceilPrecision1(float64(c.Max)/10),
+		)
+		if i+1 < len(keys) {
+			_, _ = fmt.Fprint(w, ", ")
+		}
+	}
+	_, _ = fmt.Fprint(w, "}\n")
+}
+
+// randomTable returns n stations with count measurements each of up to ±limit tenths.
+func randomTable(rng *rand.Rand, n, count, limit int) Table {
+	t := make(Table, n)
+	for i := range n {
+		s := &Station{Min: limit, Max: -limit}
+		for range count {
+			v := rng.IntN(2*limit+1) - limit
+			s.Min, s.Max = min(s.Min, v), max(s.Max, v)
+			s.Sum += v
+			s.Count++
+		}
+		t[fmt.Sprintf("station %d", i)] = s
+	}
+	return t
+}
+
+func TestPrintCities(t *testing.T) {
+	tables := []Table{
+		{},
+		{
+			"Abha":     {Min: -42, Max: 242, Sum: 200, Count: 2},
+			"Zero":     {Min: -1, Max: 0, Sum: -1, Count: 3}, // mean "-0.0"
+			"Wide":     {Min: -2731, Max: 12345678, Sum: 12342947, Count: 2},
+			"Beyond":   {Min: -maxTenths, Max: 1 << 60, Sum: 1<<60 - maxTenths, Count: 2},
+			"Boundary": {Min: 1 - maxTenths, Max: maxTenths - 1, Sum: 0, Count: 2},
+		},
+	}
+	rng := rand.New(rand.NewPCG(1, 2))
+	for _, limit := range []int{9, 999, 99_999} {
+		for _, count := range []int{1, 3, 7} {
+			tables = append(tables, randomTable(rng, 1000, count, limit))
+		}
+	}
+
+	for _, table := range tables {
+		var want, got bytes.Buffer
+		printCitiesFmt(&want, table)
+		PrintCities(&got, table)
+		if got.String() != want.String() {
+			t.Errorf("got %q, want %q", got.String(), want.String())
+		}
+	}
+
+	// min and max are formatted as integers up to maxTenths
+	for tenths := -maxTenths + 1; tenths < maxTenths; tenths += 7 {
+		if ceilPrecision1(float64(tenths)/10)*10 != float64(tenths) {
+			t.Fatalf("%d tenths aren't formatted as integers", tenths)
+		}
+	}
+}
+
+func BenchmarkPrintCities(b *testing.B) {
+	table := randomTable(rand.New(rand.NewPCG(1, 2)), 10_000, 5, 999)
+	for _, bm := range []struct {
+		name  string
+		print func(io.Writer, Table)
+	}{{"fmt", printCitiesFmt}, {"append", PrintCities}} {
+		b.Run(bm.name, func(b *testing.B) {
+			// os.Stdout isn't buffered either
+			f, err := os.Create(filepath.Join(b.TempDir(), "out.txt"))
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer f.Close()
+			for range b.N {
+				bm.print(f, table)
+			}
+		})
+	}
+}
+
+func TestTop(t *testing.T) {
+	table := Table{
+		"a": {Min: -50, Max: 100, Sum: 100, Count: 4},    // mean 2.5, range 15
+		"b": {Min: 10, Max: 300, Sum: 310, Count: 2},     // mean 15.5, range 29
+		"c": {Min: -200, Max: -100, Sum: -300, Count: 2}, // mean -15, range 10
+		"d": {Min: 10, Max: 10, Sum: 10, Count: 1},       // mean 1, range 0
+		"e": {Min: 0, Max: 150, Sum: 150, Count: 2},      // mean 7.5, range 15
+	}
+
+	names := func(records []Record) string {
+		var s []string
+		for _, r := range records {
+			s = append(s, r.Name)
+		}
+		return strings.Join(s, ",")
+	}
+
+	tests := []struct {
+		got  []Record
+		want string
+	}{
+		{table.Top(2, Mean), "b,e"},
+		{table.Bottom(2, Mean), "c,d"},
+		{table.Top(3, Range), "b,a,e"}, // ties by name
+		{table.Bottom(1, Min), "c"},
+		{table.Top(1, Max), "b"},
+		{table.Top(2, Count), "a,b"},
+		{table.Top(10, Mean), "b,e,a,d,c"},
+		{table.Top(0, Mean), ""},
+	}
+	for i, tt := range tests {
+		if got := names(tt.got); got != tt.want {
+			t.Errorf("%d: got %s, want %s", i, got, tt.want)
+		}
+	}
+
+	if s, err := ParseStat("range"); s != Range || err != nil {
+		t.Errorf("ParseStat(range) = %v, %v", s, err)
+	}
+	if _, err := ParseStat("median"); err == nil {
+		t.Error("ParseStat(median) succeeded")
+	}
+}
+
+func TestFilter(t *testing.T) {
+	var f Filter
+	for _, rule := range []string{"prefix:Ham", "regexp:^B.*o$", "name:Abha"} {
+		if err := f.Include.Add(rule); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := f.Exclude.Add("name:Hamm"); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, keep := range map[string]bool{
+		"Hamburg": true, "Hamm": false, "Bulawayo": true, "Bonn": false, "Abha": true, "Abhas": false,
+	} {
+		if f.Keep(name) != keep {
+			t.Errorf("Keep(%q) = %v", name, !keep)
+		}
+	}
+
+	for _, rule := range []string{"Hamburg", "glob:H*", "regexp:("} {
+		if err := f.Include.Add(rule); err == nil {
+			t.Errorf("Add(%q) succeeded", rule)
+		}
+	}
+}
+
+func TestOrder(t *testing.T) {
+	table := Table{
+		"Zürich":    {Min: 10, Max: 20, Sum: 30, Count: 2},
+		"Ürümqi":    {Min: -50, Max: 300, Sum: 250, Count: 2},
+		"Abha":      {Min: 10, Max: 150, Sum: 160, Count: 2},
+		"Ängelholm": {Min: 0, Max: 20, Sum: 20, Count: 2},
+		"zwickau":   {Min: 10, Max: 10, Sum: 10, Count: 1},
+	}
+
+	tests := []struct {
+		order string
+		want  []string
+	}{
+		{"name", []string{"Abha", "Zürich", "zwickau", "Ängelholm", "Ürümqi"}},
+		{"-name", []string{"Ürümqi", "Ängelholm", "zwickau", "Zürich", "Abha"}},
+		{"collate:de", []string{"Abha", "Ängelholm", "Ürümqi", "Zürich", "zwickau"}},
+		{"collate:sv", []string{"Abha", "Ürümqi", "zwickau", "Zürich", "Ängelholm"}}, // Swedish sorts Ü like Y and Ä after Z
+		{"min", []string{"Ürümqi", "Ängelholm", "Abha", "Zürich", "zwickau"}},
+		{"-max", []string{"Ürümqi", "Abha", "Zürich", "Ängelholm", "zwickau"}},
+		{"count", []string{"zwickau", "Abha", "Zürich", "Ängelholm", "Ürümqi"}},
+	}
+	for _, tt := range tests {
+		o, err := ParseOrder(tt.order)
+		if err != nil {
+			t.Fatal(err)
+		}
+		records := table.Records()
+		o.Sort(records)
+		var got []string
+		for _, r := range records {
+			got = append(got, r.Name)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.order, got, tt.want)
+		}
+	}
+
+	// records which weren't made from a table are ordered by their values
+	records := []Record{{Name: "a", Max: 2.5, Count: 1}, {Name: "b", Max: 30, Count: 1}, {Name: "c", Max: -1, Count: 1}}
+	Order{ByStat: true, Stat: Max}.Sort(records)
+	if got := []string{records[0].Name, records[1].Name, records[2].Name}; !slices.Equal(got, []string{"c", "a", "b"}) {
+		t.Errorf("literals: got %q", got)
+	}
+
+	for _, order := range []string{"median", "collate:", "collate:not a language", "--max"} {
+		if _, err := ParseOrder(order); err == nil {
+			t.Errorf("ParseOrder(%q) succeeded", order)
+		}
+	}
+}
+
+func TestNormalization(t *testing.T) {
+	const nfc, nfd = "M\u00fcnchen", "Mu\u0308nchen"
+	tests := []struct {
+		n          Normalization
+		name, want string
+	}{
+		{Normalization{}, nfd, nfd},
+		{Normalization{NFC: true}, nfd, nfc},
+		{Normalization{NFC: true}, nfc, nfc},
+		{Normalization{Fold: true}, "HAMBURG", "hamburg"},
+		{Normalization{NFC: true, Fold: true}, "MU\u0308NCHEN", "m\u00fcnchen"},
+		{Normalization{Trim: true}, " Hamburg\t", "Hamburg"},
+		{Normalization{NFC: true, Fold: true, Trim: true}, " Stra\u00dfe ", "strasse"},
+	}
+	for _, tt := range tests {
+		if got := tt.n.Apply(tt.name); got != tt.want {
+			t.Errorf("%+v.Apply(%q) = %q, want %q", tt.n, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestConvert(t *testing.T) {
+	table := Table{
+		"a": {Min: -42, Max: 242, Sum: 200, Count: 2},      // -4.2/10.0/24.2 °C
+		"b": {Min: -2731, Max: 1000, Sum: -1731, Count: 3}, // mean -57.7 °C
+	}
+
+	tests := []struct {
+		from, to Unit
+		want     string
+	}{
+		{Celsius, Celsius, "{a=-4.2/10.0/24.2, b=-273.1/-57.7/100.0}\n"},
+		// -4.2 °C = 24.44 °F, 24.2 °C = 75.56 °F, -273.1 °C = -459.58 °F, -57.7 °C = -71.86 °F
+		{Celsius, Fahrenheit, "{a=24.5/50.0/75.6, b=-459.5/-71.8/212.0}\n"},
+		// -4.2 °C = 268.95 K, 10 °C = 283.15 K
+		{Celsius, Kelvin, "{a=269.0/283.2/297.4, b=0.1/215.5/373.2}\n"},
+		// -4.2 °F = -20.111 °C, 10 °F = -12.222 °C, 24.2 °F = -4.333 °C
+		{Fahrenheit, Celsius, "{a=-20.1/-12.2/-4.3, b=-169.5/-49.8/37.8}\n"},
+		// -4.2 K = -277.35 °C
+		{Kelvin, Celsius, "{a=-277.3/-263.1/-248.9, b=-546.2/-330.8/-173.1}\n"},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		_ = PrintRecords(&buf, Convert(table.Records(), Conversion{From: tt.from, To: tt.to, Digits: 1, OutputDigits: 1}))
+		if buf.String() != tt.want {
+			t.Errorf("%c to %c: got %q, want %q", tt.from, tt.to, buf.String(), tt.want)
+		}
+	}
+
+	// records which weren't made from a table are converted from their values
+	var decoded []Record
+	if err := json.Unmarshal([]byte(`[{"name":"a","min":-4.2,"mean":10,"max":24.2,"count":2,"sum":20}]`), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	decoded = append(decoded, Record{Name: "empty"})
+	var buf bytes.Buffer
+	_ = PrintRecords(&buf, Convert(decoded, Conversion{To: Fahrenheit, Digits: 1, OutputDigits: 1}))
+	if want := "{a=24.5/50.0/75.6, empty=0.0/0.0/0.0}\n"; buf.String() != want {
+		t.Errorf("decoded: got %q, want %q", buf.String(), want)
+	}
+
+	if u, err := ParseUnit("fahrenheit"); u != Fahrenheit || err != nil {
+		t.Errorf("ParseUnit(fahrenheit) = %v, %v", u, err)
+	}
+}
+
+func TestWritePrometheusRowsOnly(t *testing.T) {
+	records := Table{"Abha": {Min: -42, Max: 242, Sum: 200, Count: 2}}.Records()
+	for _, c := range []Counters{{Rows: 2}, {Rows: 2, RowsOnly: true}} {
+		var buf bytes.Buffer
+		if err := WritePrometheus(&buf, records, c); err != nil {
+			t.Fatal(err)
+		}
+		out := buf.String()
+		if !strings.Contains(out, "brc_rows_parsed_total 2\n") {
+			t.Errorf("%+v: rows missing in %q", c, out)
+		}
+		for _, name := range []string{"brc_bytes_read_total", "brc_parse_errors_total"} {
+			if strings.Contains(out, name) == c.RowsOnly {
+				t.Errorf("%+v: %s written %v", c, name, !c.RowsOnly)
+			}
+		}
+	}
+}
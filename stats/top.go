@@ -0,0 +1,115 @@
+package stats
+
+import (
+	"container/heap"
+	"fmt"
+)
+
+// Stat is a statistic stations can be ranked by.
+type Stat int
+
+const (
+	Mean Stat = iota
+	Min
+	Max
+	Count
+	Range // Max - Min
+)
+
+var statNames = [...]string{Mean: "mean", Min: "min", Max: "max", Count: "count", Range: "range"}
+
+func (s Stat) String() string {
+	return statNames[s]
+}
+
+// ParseStat is the inverse of [Stat.String].
+func ParseStat(name string) (Stat, error) {
+	for s, n := range statNames {
+		if n == name {
+			return Stat(s), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown statistic %q", name)
+}
+
+// value is exact besides the mean, which is only used for comparisons.
+func (s Stat) value(c *Station) float64 {
+	switch s {
+	case Min:
+		return float64(c.Min)
+	case Max:
+		return float64(c.Max)
+	case Count:
+		return float64(c.Count)
+	case Range:
+		return float64(c.Max - c.Min)
+	default:
+		return float64(c.Sum) / float64(c.Count)
+	}
+}
+
+// Top returns the k stations with the highest by, the highest first.
+// Ties are ordered by name. Only k stations are kept at a time instead of sorting all of t.
+func (t Table) Top(k int, by Stat) []Record {
+	return t.rank(k, by, true)
+}
+
+// Bottom returns the k stations with the lowest by, the lowest first.
+func (t Table) Bottom(k int, by Stat) []Record {
+	return t.rank(k, by, false)
+}
+
+type ranked struct {
+	name  string
+	value float64
+}
+
+func (t Table) rank(k int, by Stat, highest bool) []Record {
+	if k <= 0 {
+		return nil
+	}
+
+	// before reports if a is ranked before b
+	before := func(a, b ranked) bool {
+		if a.value != b.value {
+			return (a.value > b.value) == highest
+		}
+		return a.name < b.name
+	}
+
+	// the root of h is the last of the k stations kept so far
+	h := &rankHeap{less: func(a, b ranked) bool { return before(b, a) }}
+	for name, c := range t {
+		r := ranked{name, by.value(c)}
+		switch {
+		case h.Len() < k:
+			heap.Push(h, r)
+		case before(r, h.entries[0]):
+			h.entries[0] = r
+			heap.Fix(h, 0)
+		}
+	}
+
+	records := make([]Record, h.Len())
+	for i := len(records) - 1; i >= 0; i-- {
+		r := heap.Pop(h).(ranked)
+		records[i] = newRecord(r.name, t[r.name])
+	}
+	return records
+}
+
+// rankHeap implements [heap.Interface].
+type rankHeap struct {
+	entries []ranked
+	less    func(a, b ranked) bool
+}
+
+func (h *rankHeap) Len() int           { return len(h.entries) }
+func (h *rankHeap) Less(i, j int) bool { return h.less(h.entries[i], h.entries[j]) }
+func (h *rankHeap) Swap(i, j int)      { h.entries[i], h.entries[j] = h.entries[j], h.entries[i] }
+func (h *rankHeap) Push(x any)         { h.entries = append(h.entries, x.(ranked)) }
+func (h *rankHeap) Pop() any {
+	last := h.entries[len(h.entries)-1]
+	h.entries = h.entries[:len(h.entries)-1]
+	return last
+}
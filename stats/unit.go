@@ -0,0 +1,165 @@
+package stats
+
+import (
+	"cmp"
+	"fmt"
+	"strings"
+)
+
+// Unit is a unit of temperature.
+type Unit byte
+
+const (
+	Celsius    Unit = 'C'
+	Fahrenheit Unit = 'F'
+	Kelvin     Unit = 'K'
+)
+
+// ParseUnit parses "C", "F" or "K" or the name of the unit.
+func ParseUnit(s string) (Unit, error) {
+	for _, u := range []Unit{Celsius, Fahrenheit, Kelvin} {
+		if s == string(u) || strings.EqualFold(s, u.Name()) {
+			return u, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown unit %q, one of C, F or K", s)
+}
+
+// Name is the lower case name, e.g. "celsius", the zero value is Celsius as well.
+func (u Unit) Name() string {
+	switch u {
+	case Fahrenheit:
+		return "fahrenheit"
+	case Kelvin:
+		return "kelvin"
+	default:
+		return "celsius"
+	}
+}
+
+func (u Unit) MarshalText() ([]byte, error) {
+	return []byte{byte(u)}, nil
+}
+
+func (u *Unit) UnmarshalText(b []byte) error {
+	var err error
+	*u, err = ParseUnit(string(b))
+	return err
+}
+
+// affine converts x to (p*x + q) / r.
+type affine struct {
+	p, q, r int64
+}
+
+// the unit conversions are on tenths of a degree
+
+func (u Unit) toCelsius() affine {
+	switch u {
+	case Fahrenheit: // (x - 320) * 5/9
+		return affine{5, -1600, 9}
+	case Kelvin: // x - 2731.5
+		return affine{2, -5463, 2}
+	default:
+		return affine{1, 0, 1}
+	}
+}
+
+func (u Unit) fromCelsius() affine {
+	switch u {
+	case Fahrenheit: // x * 9/5 + 320
+		return affine{9, 1600, 5}
+	case Kelvin: // x + 2731.5
+		return affine{2, 5463, 2}
+	default:
+		return affine{1, 0, 1}
+	}
+}
+
+// scale converts from 10^-from to 10^-to units, e.g. from hundredths to tenths.
+func scale(from, to int) affine {
+	return affine{pow10(to), 0, pow10(from)}
+}
+
+func pow10(n int) int64 {
+	p := int64(1)
+	for range n {
+		p *= 10
+	}
+	return p
+}
+
+// then returns the conversion of a followed by b, reduced so the numbers stay small.
+func (a affine) then(b affine) affine {
+	c := affine{b.p * a.p, b.p*a.q + b.q*a.r, a.r * b.r}
+	d := gcd(gcd(c.p, c.q), c.r)
+	return affine{c.p / d, c.q / d, c.r / d}
+}
+
+func gcd(a, b int64) int64 {
+	if a < 0 {
+		a = -a
+	}
+	if b < 0 {
+		b = -b
+	}
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+// Conversion describes how the integers of a [Table] become the values of a [Record].
+type Conversion struct {
+	From, To Unit // 0 is Celsius
+
+	// Digits is the number of fractional digits of the integers, i.e. 1 for tenths as in the challenge,
+	// OutputDigits the one of the records.
+	Digits, OutputDigits int
+}
+
+// Convert returns records with the temperatures converted as described by c.
+// The values are computed from the integer aggregates of the stations and rounded up,
+// like [PrintCities] rounds, instead of converting the already rounded values.
+// Converting tenths of a degree Celsius into the same only marks the records with the unit,
+// as do records without measurements. Records which weren't made from a [Table] are converted from their values in c.From.
+func Convert(records []Record, c Conversion) []Record {
+	from, to := cmp.Or(c.From, Celsius), cmp.Or(c.To, Celsius)
+
+	converted := make([]Record, len(records))
+	copy(converted, records)
+
+	a := scale(c.Digits, 1).then(from.toCelsius()).then(to.fromCelsius()).then(scale(1, c.OutputDigits))
+	div := float64(pow10(c.OutputDigits))
+	for i := range converted {
+		r := &converted[i]
+		r.Unit = to
+		r.digits = c.OutputDigits
+		s := r.aggregates(c.Digits)
+		if a == (affine{1, 0, 1}) && c.OutputDigits == 1 || s.Count == 0 {
+			continue
+		}
+
+		count := int64(s.Count)
+		r.converted = true
+		r.fixed = [3]int64{
+			ceilDiv(a.p*int64(s.Min)+a.q, a.r),
+			ceilDiv(a.p*int64(s.Sum)+a.q*count, a.r*count),
+			ceilDiv(a.p*int64(s.Max)+a.q, a.r),
+		}
+		r.Min = float64(r.fixed[0]) / div
+		r.Mean = float64(r.fixed[1]) / div
+		r.Max = float64(r.fixed[2]) / div
+		r.Sum = float64(a.p*int64(s.Sum)+a.q*count) / float64(a.r) / div
+	}
+	return converted
+}
+
+// ceilDiv returns ⌈a/b⌉ for b > 0.
+func ceilDiv(a, b int64) int64 {
+	q := a / b
+	if a%b > 0 {
+		q++
+	}
+	return q
+}